@@ -0,0 +1,270 @@
+package main
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+// time between generations at each speed, slowest first
+var automatonSpeeds = []time.Duration{time.Second, 500 * time.Millisecond, 250 * time.Millisecond, 125 * time.Millisecond, 60 * time.Millisecond}
+
+// speed automaton layers start at
+const automatonDefaultSpeed = 2
+
+// colors of live cells by age in generations, the last one is kept by older cells
+var defaultAgeColors = []Color{green, lime, yellow, amber, orange, red}
+
+// color of Langton's Ant
+var defaultAntColor = red
+
+// chance of a cell being alive after randomizing
+const automatonDensity = 0.3
+
+// right column controls of automaton layers, top to bottom
+const (
+	automatonRun    = iota // start and pause
+	automatonStep          // advance one generation
+	automatonSlower        // lower the speed
+	automatonFaster        // raise the speed
+	automatonRandom        // fill the grid with random cells
+	automatonClear         // kill every cell
+	automatonWrap          // toggle the torus, where the edges wrap around
+	automatonSeed          // start from the pads lit when the layer was entered, such as a Paint drawing
+)
+
+// settings of an automaton layer from the macro config table named after the layer
+type automatonConfig struct {
+	rule     string  // rule parsed by parseRule
+	wrap     bool    // edges wrap around, making the grid a torus
+	colors   []Color // colors of live cells by age, nil for defaultAgeColors
+	antColor *Color  // color of Langton's Ant, nil for defaultAntColor
+}
+
+// automaton layers and their settings without a config table
+var defaultAutomata = map[string]automatonConfig{
+	"life":      {rule: "B3/S23", wrap: true},
+	"automaton": {rule: "B36/S23", wrap: true},
+}
+
+// cellular automaton running on the grid, such as Conway's Game of Life
+type automatonLayer struct {
+	lp       *launchpad
+	name     string        // layer and config table name
+	rule     automatonRule // rule advancing the cells
+	grid     cellGrid      // cells, which survive switching layers
+	canvas   [8][8]bool    // pads lit when the layer was entered
+	saved    [8][8]Color   // grid colors when the layer was entered, put back when leaving
+	colors   []Color       // colors of live cells by age
+	antColor Color         // color of Langton's Ant
+	running  bool          // generations advance on every tick
+	speed    int           // index into automatonSpeeds
+}
+
+// function to create an automaton layer at its default speed
+func newAutomatonLayer(lp *launchpad, name string) *automatonLayer {
+	return &automatonLayer{lp: lp, name: name, speed: automatonDefaultSpeed}
+}
+
+func (l *automatonLayer) Name() string {
+	return l.name
+}
+
+// function to pick up the config, keep the grid to seed from and show the cells
+func (l *automatonLayer) Enter() error {
+	if err := l.configure(); err != nil {
+		return err
+	}
+
+	// the grid still shows the previous layer, a refresh turned it off first
+	f := l.lp.newFrame()
+	var canvas [8][8]bool
+	lit := false
+	for _, row := range l.lp.gridButtons {
+		for _, b := range row {
+			l.saved[b.y][b.x] = f[b.frameIndex()]
+			canvas[b.y][b.x] = !f[b.frameIndex()].isOff()
+			lit = lit || canvas[b.y][b.x]
+		}
+	}
+	if lit {
+		l.canvas = canvas
+	}
+	return l.draw()
+}
+
+// function to apply the layer's config, the cells are kept unless the rule changed
+func (l *automatonLayer) configure() error {
+	cfg := l.lp.automatonConfig(l.name)
+	// the config was checked when loaded, a new rule starts over
+	if l.rule == nil || l.rule.String() != cfg.rule {
+		rule, err := parseRule(cfg.rule)
+		if err != nil {
+			return err
+		}
+		l.rule = rule
+		l.running = false
+	}
+	l.grid.wrap = cfg.wrap
+	l.colors = cfg.colors
+	if l.colors == nil {
+		l.colors = defaultAgeColors
+	}
+	l.antColor = defaultAntColor
+	if cfg.antColor != nil {
+		l.antColor = *cfg.antColor
+	}
+	return nil
+}
+
+// function to put back the grid the layer was entered with, such as a Paint drawing, and remove the controls
+func (l *automatonLayer) Exit() error {
+	f := l.lp.newFrame()
+	for _, row := range l.lp.gridButtons {
+		for _, b := range row {
+			f.set(b, l.saved[b.y][b.x])
+		}
+	}
+	if err := l.lp.flush(f); err != nil {
+		return err
+	}
+	for _, b := range l.lp.rightButtons {
+		if err := b.overlayOff(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function to toggle cells with the grid and run the controls in the right column
+func (l *automatonLayer) HandleEvent(b *button) error {
+	if !b.pressed {
+		return nil
+	}
+	cells := &l.grid.cells
+	if b.bType == GRID {
+		if cells[b.y][b.x] > 0 {
+			cells[b.y][b.x] = 0
+		} else {
+			cells[b.y][b.x] = 1
+		}
+		return l.draw()
+	}
+	if b.bType != RIGHT {
+		return nil
+	}
+
+	switch b.y {
+	case automatonRun:
+		l.running = !l.running
+	case automatonStep:
+		l.step()
+	case automatonSlower:
+		l.speed = max(l.speed-1, 0)
+	case automatonFaster:
+		l.speed = min(l.speed+1, len(automatonSpeeds)-1)
+	case automatonRandom:
+		for y := range cells {
+			for x := range cells[y] {
+				cells[y][x] = 0
+				if rand.Float64() < automatonDensity {
+					cells[y][x] = 1
+				}
+			}
+		}
+		l.rule.reset()
+	case automatonClear:
+		*cells = [8][8]int{}
+		l.rule.reset()
+		l.running = false
+	case automatonWrap:
+		l.grid.wrap = !l.grid.wrap
+	case automatonSeed:
+		for y := range cells {
+			for x := range cells[y] {
+				cells[y][x] = 0
+				if l.canvas[y][x] {
+					cells[y][x] = 1
+				}
+			}
+		}
+		l.rule.reset()
+	}
+	slog.Debug("Automaton control", "device", l.lp.device.id, "layer", l.name, "rule", l.rule, "control", b.y, "running", l.running, "speed", automatonSpeeds[l.speed], "wrap", l.grid.wrap)
+	return l.draw()
+}
+
+// function to tick once per generation while running
+func (l *automatonLayer) TickInterval() time.Duration {
+	if !l.running {
+		return 0
+	}
+	return automatonSpeeds[l.speed]
+}
+
+func (l *automatonLayer) Tick() error {
+	l.step()
+	return l.draw()
+}
+
+// function to advance one generation, pausing once nothing more can happen
+func (l *automatonLayer) step() {
+	if !l.rule.step(&l.grid) {
+		l.running = false
+	}
+}
+
+// function to draw the cells colored by age in one frame and light the controls
+func (l *automatonLayer) draw() error {
+	f := l.lp.newFrame()
+	for _, row := range l.lp.gridButtons {
+		for _, b := range row {
+			color := off
+			if age := l.grid.cells[b.y][b.x]; age > 0 {
+				color = l.colors[min(age, len(l.colors))-1]
+			}
+			f.set(b, color)
+		}
+	}
+	if ant, ok := l.rule.(*antRule); ok && ant.placed {
+		f.set(l.lp.gridButtons[ant.y][ant.x], l.antColor)
+	}
+	if err := l.lp.flush(f); err != nil {
+		return err
+	}
+	return l.controlLights()
+}
+
+// function to light the right column controls over the color pallette
+func (l *automatonLayer) controlLights() error {
+	lights := [8]Color{
+		automatonRun:    dimGreen,
+		automatonStep:   yellow,
+		automatonSlower: dimRed,
+		automatonFaster: red,
+		automatonRandom: amber,
+		automatonClear:  orange,
+		automatonWrap:   dimGreen,
+		automatonSeed:   lime,
+	}
+	if l.running {
+		lights[automatonRun] = green
+	}
+	if l.grid.wrap {
+		lights[automatonWrap] = paleGreen
+	}
+	for i, b := range l.lp.rightButtons {
+		if err := b.overlayOn(lights[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function to get the settings of an automaton layer from the macro config
+func (lp *launchpad) automatonConfig(name string) automatonConfig {
+	if cfg, ok := lp.automata[name]; ok {
+		return cfg
+	}
+	return defaultAutomata[name]
+}
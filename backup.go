@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// number of previous macro configs kept, changed by the -backups flag
+var macroBackups = 5
+
+// directory next to a macro config holding its backups
+const backupDir = "backups"
+
+// directory in backupDir holding the configs replaced by an undo
+const undoneDir = "undone"
+
+// timestamp added to backup file names, sorts oldest first
+const backupTime = "20060102-150405.000"
+
+// function to replace a file so that readers and crashes only ever see the old or the new contents
+func writeFileAtomic(path string, data []byte) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	// write the new contents next to the file and make sure they reach the disk
+	tmp, err := os.CreateTemp(dir, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// swap the files in one step, then persist the rename itself
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// function to flush a directory so renames and new files in it survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// function to copy the current contents of a file into its backup directory, dropping the oldest backups
+func backupFile(path string) error {
+	return backupInto(path, filepath.Join(filepath.Dir(path), backupDir))
+}
+
+// function to copy the current contents of a file into a directory of backups, dropping the oldest ones
+func backupInto(path, dir string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if macroBackups <= 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	// backups made within the same millisecond get the next free timestamp, so none is overwritten
+	at := time.Now()
+	backup := filepath.Join(dir, filepath.Base(path)+"."+at.Format(backupTime))
+	for {
+		if _, err := os.Stat(backup); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		at = at.Add(time.Millisecond)
+		backup = filepath.Join(dir, filepath.Base(path)+"."+at.Format(backupTime))
+	}
+	if err := writeFileAtomic(backup, data); err != nil {
+		return err
+	}
+
+	// rotate
+	backups, err := listBackups(path, dir)
+	if err != nil {
+		return err
+	}
+	for len(backups) > macroBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// function to get the backups of a file in a directory, oldest first
+func listBackups(path, dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	prefix := filepath.Base(path) + "."
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix) {
+			backups = append(backups, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// function to put the newest backup of a file back in place, the backup is used up so
+// repeated calls step further back. The contents it replaces are kept in backups/undone,
+// so an undo by mistake or after hand edits loses nothing.
+func restoreBackup(path string) ([]byte, error) {
+	dir := filepath.Join(filepath.Dir(path), backupDir)
+	backups, err := listBackups(path, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("No backups of %s to restore", path)
+	}
+	newest := backups[len(backups)-1]
+	data, err := os.ReadFile(newest)
+	if err != nil {
+		return nil, err
+	}
+	if err := backupInto(path, filepath.Join(dir, undoneDir)); err != nil {
+		return nil, fmt.Errorf("Error backing up macro config before restoring: %v", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(newest); err != nil {
+		return nil, err
+	}
+	slog.Info("Restored macro config", "file", path, "backup", newest)
+	return data, nil
+}
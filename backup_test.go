@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// function to read a file, failing the test when it can't
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// function to read every backup of a file in a directory, oldest first
+func backupContents(t *testing.T, path, dir string) []string {
+	t.Helper()
+	backups, err := listBackups(path, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, backup := range backups {
+		contents = append(contents, readFile(t, backup))
+	}
+	return contents
+}
+
+// function to set how many backups are kept until the test ends
+func setBackups(t *testing.T, n int) {
+	old := macroBackups
+	macroBackups = n
+	t.Cleanup(func() {
+		macroBackups = old
+	})
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "macros.toml")
+
+	// creates the file, then replaces it
+	for _, data := range []string{"version = 1\n", "version = 1\n\n[[pad]]\n"} {
+		if err := writeFileAtomic(path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, path); got != data {
+			t.Errorf("file holds %q, want %q", got, data)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("file mode %v, want 0644", info.Mode().Perm())
+	}
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the config", len(entries))
+	}
+
+	// a missing directory is an error and leaves nothing behind
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "macros.toml"), []byte("x")); err == nil {
+		t.Error("wrote into a missing directory")
+	}
+}
+
+func TestBackupRotation(t *testing.T) {
+	setBackups(t, 3)
+	path := filepath.Join(t.TempDir(), "macros.toml")
+	dir := filepath.Join(filepath.Dir(path), backupDir)
+
+	// nothing to back up before the file exists
+	if err := backupFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := backupContents(t, path, dir); got != nil {
+		t.Errorf("backups of a missing file: %q", got)
+	}
+
+	// only the newest backups are kept, even when made within the same millisecond
+	for _, data := range []string{"1", "2", "3", "4", "5"} {
+		if err := os.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := backupFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := backupContents(t, path, dir); !slices.Equal(got, []string{"3", "4", "5"}) {
+		t.Errorf("backups hold %q, want the last 3", got)
+	}
+
+	// -backups 0 keeps none
+	setBackups(t, 0)
+	if err := backupFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := backupContents(t, path, dir); len(got) != 3 {
+		t.Errorf("%d backups after a backup with -backups 0, want the 3 from before", len(got))
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	setBackups(t, 5)
+	path := filepath.Join(t.TempDir(), "macros.toml")
+	undone := filepath.Join(filepath.Dir(path), backupDir, undoneDir)
+
+	if _, err := restoreBackup(path); err == nil {
+		t.Error("restored without any backups")
+	}
+
+	// three saves through saveConfig, then a hand edit
+	for _, data := range []string{"1", "2", "3"} {
+		if err := backupFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFileAtomic(path, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, []byte("hand edit"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// each restore steps further back, keeping what it replaced
+	for _, want := range []string{"2", "1"} {
+		data, err := restoreBackup(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want || readFile(t, path) != want {
+			t.Errorf("restored %q, file holds %q, want %q", data, readFile(t, path), want)
+		}
+	}
+	if _, err := restoreBackup(path); err == nil {
+		t.Error("restored past the oldest backup")
+	}
+	if readFile(t, path) != "1" {
+		t.Errorf("failed restore changed the file to %q", readFile(t, path))
+	}
+	if got := backupContents(t, path, undone); !slices.Equal(got, []string{"hand edit", "2"}) {
+		t.Errorf("undone configs hold %q, want the hand edit and the config after it was undone", got)
+	}
+}
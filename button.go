@@ -2,22 +2,25 @@ package main
 
 import (
 	"fmt"
-	"math"
-	"os/exec"
-	"strings"
+	"log/slog"
 	"time"
 )
 
 // button struct
 type button struct {
-	row        int    // topRow or gridRow
-	x          int    // collumn index
-	y          int    // row index
-	color      int    // current button color
-	macroColor int    // saved macro led color
-	bType      int    // 0: top, 1: right, 2: grid
-	pressed    bool   // currently held down
-	cmd        string // linux command executed when button gets pressed
+	row        int             // topRow or gridRow
+	x          int             // collumn index
+	y          int             // row index
+	macroColor Color           // saved macro led color
+	bType      int             // 0: top, 1: right, 2: grid
+	pressed    bool            // currently held down
+	cmd        string          // linux command executed when button gets pressed
+	action     string          // built in action run instead of a command
+	gestures   gestureCommands // commands of the other gestures
+	toggle     toggleCommands  // on and off commands run in turn instead of cmd
+	label      string          // short description of the macro
+	options    *execOptions    // how the command is run, nil uses defaultExec
+	leds       *renderer       // LED state shared by all buttons
 }
 
 // button types enum
@@ -28,89 +31,90 @@ const (
 )
 
 // function to turn led at x,y on to specified color
-func (b *button) ledOn(color int) error {
-	if color > 0 {
-		b.color = color
-	}
-	color = int(math.Abs(float64(color)))
-	args := append(pushArgs, fmt.Sprintf("%X %d%d %X", b.row, b.y, b.x, color))
-	if b.bType == TOP {
-		args = append(pushArgs, fmt.Sprintf("%X %d%X %X", b.row, b.y, b.x+8, color))
-	}
-	cmd := exec.Command(lpCmd, args...)
-	return cmd.Run()
-
+func (b *button) ledOn(color Color) error {
+	return b.leds.set(b.frameIndex(), color)
 }
 
 // function to turn off led at x,y
 func (b *button) ledOff() error {
-	b.color = off
-	args := append(pushArgs, fmt.Sprintf("%X %d%d 00", b.row, b.y, b.x))
+	return b.leds.set(b.frameIndex(), off)
+}
+
+// function to draw a temporary color over the saved button color
+func (b *button) overlayOn(color Color) error {
+	return b.leds.setOverlay(b.frameIndex(), color)
+}
+
+// function to remove the temporary color and show the saved button color again
+func (b *button) overlayOff() error {
+	return b.leds.setOverlay(b.frameIndex(), transparent)
+}
+
+// function to get the saved button color
+func (b *button) color() Color {
+	return b.leds.color(b.frameIndex())
+}
+
+// function to get the midi note or controller number of the button
+func (b *button) note() byte {
+	// top row controllers start at 0x68
 	if b.bType == TOP {
-		args = append(pushArgs, fmt.Sprintf("%X %d%X 00", b.row, b.y, b.x+8))
+		return byte(b.y*16 + b.x + 8)
 	}
-	cmd := exec.Command(lpCmd, args...)
-	return cmd.Run()
+	return byte(b.y*16 + b.x)
 }
 
 // function to flash a buttons LED n times
-func (b *button) flash(color int, n int, delay int) error {
+func (b *button) flash(color Color, n int, delay int) error {
 	// repeat n times
 	for range n {
 		// on
-		if err := b.ledOn(-color); err != nil {
+		if err := b.overlayOn(color); err != nil {
 			return fmt.Errorf("Error flashing button: %v", err)
 		}
 		time.Sleep(time.Millisecond * time.Duration(delay))
 		// off
-		if err := b.ledOn(off); err != nil {
+		if err := b.overlayOn(off); err != nil {
 			return fmt.Errorf("Error flashing button: %v", err)
 		}
 		time.Sleep(time.Millisecond * time.Duration(delay))
 	}
-	b.ledOn(b.color)
-	return nil
+	return b.overlayOff()
+}
+
+// function to check if the button has a command or action bound
+func (b *button) bound() bool {
+	return b.cmd != "" || b.action != "" || b.gestures.any() || b.toggle.any()
+}
+
+// function to execute buttons macro command, tracking it in runs until it exits
+func (b *button) execute(runs *macroRuns) error {
+	return b.run(b.cmd, runs, nil)
 }
 
-// function to execute buttons macro command
-func (b *button) execute() error {
+// function to run one of the button's commands, done is called with the exit status when it isn't nil
+func (b *button) run(command string, runs *macroRuns, done func(err error)) error {
 
 	// return if button has no command
-	if b.cmd == "" {
+	if command == "" {
 		return nil
 	}
 
-	fmt.Println("EXECUTING COMMAND", b.cmd)
+	slog.Info("Executing macro", "row", b.y, "col", b.x, "cmd", command)
 
-	args := strings.Split(b.cmd, " ")
-	// error if no command
-	if len(args) == 0 {
-		return fmt.Errorf("No command found")
-	}
-
-	// set button command
-	var cmd *exec.Cmd
-	if len(args) == 1 {
-		cmd = exec.Command(args[0])
-	} else {
-		cmd = exec.Command(args[0], args[1:]...)
+	// use the default options unless the macro has its own
+	opts := defaultExec
+	if b.options != nil {
+		opts = *b.options
 	}
 
 	// run command
-	if err := cmd.Start(); err != nil {
+	if err := b.runMacro(command, opts, runs, done); err != nil {
 		// flash red and return error
 		go b.flash(red, 3, 333)
 		return fmt.Errorf("Error starting linux cmd: %v", err)
 	}
 
-	// flash green and exit with no error
-	b.flash(green, 3, 333/2)
-	return nil
-}
-
-// function to set the macro for a button
-func (b *button) setCMD(command string) error {
-	b.cmd = command
-	fmt.Printf("Set button %d%d command to %s\n", b.x, b.y, b.cmd)
+	// exit with no error, the button flashes once the command finishes
 	return nil
 }
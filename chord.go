@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// default time in which the pads of a chord must all be pressed
+const defaultChordTime = 80 * time.Millisecond
+
+// column of the right column buttons in a buttonPos
+const rightCol = 8
+
+// position of a grid pad, or of a right column button when col is rightCol
+type buttonPos struct {
+	row int
+	col int
+}
+
+// function to parse a button position, "row,col" for a grid pad or "right N" for a right column button
+func parseButtonPos(s string) (buttonPos, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 2 && fields[0] == "right" {
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 || n > 7 {
+			return buttonPos{}, fmt.Errorf("right column button %q doesn't exist, it must be \"right 0\" to \"right 7\"", s)
+		}
+		return buttonPos{n, rightCol}, nil
+	}
+	row, col, ok := strings.Cut(s, ",")
+	if !ok {
+		return buttonPos{}, fmt.Errorf("invalid button %q, use \"row,col\" for a pad or \"right N\" for the right column", s)
+	}
+	r, err := strconv.Atoi(strings.TrimSpace(row))
+	if err != nil || r < 0 || r > 7 {
+		return buttonPos{}, fmt.Errorf("pad %q is outside the grid, row and col must be 0-7", s)
+	}
+	c, err := strconv.Atoi(strings.TrimSpace(col))
+	if err != nil || c < 0 || c > 7 {
+		return buttonPos{}, fmt.Errorf("pad %q is outside the grid, row and col must be 0-7", s)
+	}
+	return buttonPos{r, c}, nil
+}
+
+// function to format a button position the way parseButtonPos reads it
+func (p buttonPos) String() string {
+	if p.col == rightCol {
+		return fmt.Sprintf("right %d", p.row)
+	}
+	return fmt.Sprintf("%d,%d", p.row, p.col)
+}
+
+// function to get the grid pad or right column button at a position
+func (lp *launchpad) buttonAt(p buttonPos) *button {
+	if p.col == rightCol {
+		return lp.rightButtons[p.row]
+	}
+	return lp.gridButtons[p.row][p.col]
+}
+
+// function to get the position of a grid pad or right column button
+func (b *button) pos() buttonPos {
+	return buttonPos{b.y, b.x}
+}
+
+// macro bound to a pad pressed together with other buttons, or pressed while a modifier is held
+type chordBinding struct {
+	button *button      // pad the macro is written on, it flashes with the result
+	with   []*button    // buttons pressed together with the pad, nil for shifted bindings
+	shift  *button      // modifier held down before the pad is pressed, nil for chords
+	macro  macroBinding // command or action run instead of the pads' own macros
+}
+
+// function to get every button of a chord
+func (c *chordBinding) buttons() []*button {
+	return append([]*button{c.button}, c.with...)
+}
+
+// buttons held down, fed by the button events listen posts. Layers only see
+// presses once the chord matcher lets them through, this is what is really held.
+type pressedSet map[*button]time.Time
+
+// function to record a button being pressed or released at a time
+func (s pressedSet) update(b *button, pressed bool, at time.Time) {
+	if pressed {
+		s[b] = at
+	} else {
+		delete(s, b)
+	}
+}
+
+// function to check if a button is held down
+func (s pressedSet) held(b *button) bool {
+	_, ok := s[b]
+	return ok
+}
+
+// press or release let through by the chord matcher, or a chord it recognized
+type chordEvent struct {
+	button  *button       // button pressed or released
+	pressed bool          // whether it was pressed
+	at      time.Time     // when it was pressed or released
+	chord   *chordBinding // chord or shifted binding that fired instead, nil for presses and releases
+}
+
+// press held back by the chord matcher
+type heldPress struct {
+	button   *button
+	at       time.Time
+	modifier bool // the button is a modifier, it waits until it is released or used
+}
+
+// matcher holding back presses of buttons that are part of a chord or are a modifier,
+// so a single press doesn't run its own macro before the rest of a chord arrives.
+// Each press and release carries the time listen stamped on it, and the main loop
+// asks deadline when to tick, so held back presses aren't let through by a timer of its own.
+type chordMatcher struct {
+	window  time.Duration    // time in which the buttons of a chord must all be pressed
+	pending []heldPress      // presses held back, oldest first
+	used    map[*button]bool // buttons taken by a chord, their releases are dropped
+}
+
+// function to create a matcher with the default chord time
+func newChordMatcher() *chordMatcher {
+	return &chordMatcher{window: defaultChordTime, used: map[*button]bool{}}
+}
+
+// function to find a held back press
+func (m *chordMatcher) find(b *button) int {
+	return slices.IndexFunc(m.pending, func(p heldPress) bool { return p.button == b })
+}
+
+// function to take a button, dropping its held back press and its release
+func (m *chordMatcher) take(b *button) {
+	if i := m.find(b); i >= 0 {
+		m.pending = slices.Delete(m.pending, i, i+1)
+		m.used[b] = true
+	}
+}
+
+// function to handle a button being pressed at a time, given the chords of the shown page and the held buttons
+func (m *chordMatcher) press(b *button, now time.Time, chords []chordBinding, held pressedSet) []chordEvent {
+	// a pad pressed while its modifier is held runs the shifted binding
+	for i, c := range chords {
+		if c.shift != nil && c.button == b && held.held(c.shift) {
+			m.take(c.shift)
+			m.used[b] = true
+			return []chordEvent{{button: b, at: now, chord: &chords[i]}}
+		}
+	}
+
+	// buttons that aren't part of anything go straight through
+	modifier, member := false, false
+	for _, c := range chords {
+		if c.shift != nil {
+			modifier = modifier || c.shift == b
+		} else {
+			member = member || slices.Contains(c.buttons(), b)
+		}
+	}
+	if !modifier && !member {
+		return []chordEvent{{button: b, pressed: true, at: now}}
+	}
+	m.pending = append(m.pending, heldPress{b, now, modifier})
+
+	// a chord fires once all of its buttons were pressed within the chord time
+	for i, c := range chords {
+		if c.shift != nil || !slices.Contains(c.buttons(), b) {
+			continue
+		}
+		complete := true
+		for _, cb := range c.buttons() {
+			j := m.find(cb)
+			complete = complete && j >= 0 && now.Sub(m.pending[j].at) <= m.window
+		}
+		if complete {
+			for _, cb := range c.buttons() {
+				m.take(cb)
+			}
+			return []chordEvent{{button: b, at: now, chord: &chords[i]}}
+		}
+	}
+	return nil
+}
+
+// function to handle a button being released at a time
+func (m *chordMatcher) release(b *button, now time.Time) []chordEvent {
+	// releases of buttons used by a chord were never pressed as far as layers know
+	if m.used[b] {
+		delete(m.used, b)
+		return nil
+	}
+	events := m.tick(now)
+	// a held back press that wasn't used is let through with its release
+	if i := m.find(b); i >= 0 {
+		events = append(events, chordEvent{button: b, pressed: true, at: m.pending[i].at})
+		m.pending = slices.Delete(m.pending, i, i+1)
+	}
+	return append(events, chordEvent{button: b, at: now})
+}
+
+// function to let through the held back presses whose chord time ran out, modifiers keep waiting
+func (m *chordMatcher) tick(now time.Time) []chordEvent {
+	var events []chordEvent
+	m.pending = slices.DeleteFunc(m.pending, func(p heldPress) bool {
+		if p.modifier || now.Sub(p.at) <= m.window {
+			return false
+		}
+		events = append(events, chordEvent{button: p.button, pressed: true, at: p.at})
+		return true
+	})
+	return events
+}
+
+// function to get the next time tick has a press to let through, false when nothing is waiting
+func (m *chordMatcher) deadline() (time.Time, bool) {
+	var next time.Time
+	pending := false
+	for _, p := range m.pending {
+		if t := p.at.Add(m.window + time.Nanosecond); !p.modifier && (!pending || t.Before(next)) {
+			next, pending = t, true
+		}
+	}
+	return next, pending
+}
+
+// function to forget held back presses and used buttons, such as when the layer changes
+func (m *chordMatcher) reset() {
+	m.pending = nil
+	clear(m.used)
+}
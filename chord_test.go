@@ -0,0 +1,170 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// step of a chord matcher test, a button pressed, released or a tick at a time
+type chordStep struct {
+	action string // "press", "release" or "tick"
+	button string // name of the button, empty for ticks
+	at     int    // milliseconds after the start of the test
+	want   string // events returned, such as "+a" for a press, "-a" for a release and "chord a" for a binding
+}
+
+// function to describe the events the chord matcher returned
+func describeChordEvents(events []chordEvent, names map[*button]string) string {
+	var parts []string
+	for _, ev := range events {
+		switch {
+		case ev.chord != nil:
+			parts = append(parts, "chord "+names[ev.chord.button])
+		case ev.pressed:
+			parts = append(parts, "+"+names[ev.button])
+		default:
+			parts = append(parts, "-"+names[ev.button])
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestChordMatcher(t *testing.T) {
+	buttons := map[string]*button{
+		"a":     {x: 0, y: 0, bType: GRID},
+		"b":     {x: 1, y: 0, bType: GRID},
+		"c":     {x: 2, y: 0, bType: GRID},
+		"shift": {x: 0, y: 7, bType: GRID},
+		"s":     {x: 5, y: 5, bType: GRID},
+		"t":     {x: 6, y: 5, bType: GRID},
+	}
+	names := map[*button]string{}
+	for name, b := range buttons {
+		names[b] = name
+	}
+	// a and b together fire a chord written on a, shift held down makes s and t run their shifted bindings
+	chords := []chordBinding{
+		{button: buttons["a"], with: []*button{buttons["b"]}},
+		{button: buttons["s"], shift: buttons["shift"]},
+		{button: buttons["t"], shift: buttons["shift"]},
+	}
+
+	tests := []struct {
+		name  string
+		steps []chordStep
+	}{
+		{"chord inside the window", []chordStep{
+			{"press", "a", 0, ""},
+			{"press", "b", 50, "chord a"},
+			{"release", "a", 100, ""},
+			{"release", "b", 110, ""},
+			{"tick", "", 500, ""},
+		}},
+		{"chord pressed in either order", []chordStep{
+			{"press", "b", 0, ""},
+			{"press", "a", 80, "chord a"},
+			{"release", "b", 120, ""},
+			{"release", "a", 130, ""},
+		}},
+		{"incomplete chord lets its press through", []chordStep{
+			{"press", "a", 0, ""},
+			{"tick", "", 80, ""},
+			{"tick", "", 81, "+a"},
+			{"release", "a", 200, "-a"},
+		}},
+		{"incomplete chord released early", []chordStep{
+			{"press", "a", 0, ""},
+			{"release", "a", 30, "+a -a"},
+		}},
+		{"chord outside the window", []chordStep{
+			{"press", "a", 0, ""},
+			{"tick", "", 81, "+a"},
+			{"press", "b", 100, ""},
+			{"release", "a", 150, "-a"},
+			{"release", "b", 160, "+b -b"},
+		}},
+		{"buttons outside chords go straight through", []chordStep{
+			{"press", "c", 0, "+c"},
+			{"release", "c", 10, "-c"},
+		}},
+		{"modifier used", []chordStep{
+			{"press", "shift", 0, ""},
+			{"tick", "", 1000, ""},
+			{"press", "s", 1200, "chord s"},
+			{"release", "s", 1300, ""},
+			{"release", "shift", 1400, ""},
+		}},
+		{"modifier released alone", []chordStep{
+			{"press", "shift", 0, ""},
+			{"tick", "", 1000, ""},
+			{"release", "shift", 1200, "+shift -shift"},
+		}},
+		{"second shifted press while the modifier is held", []chordStep{
+			{"press", "shift", 0, ""},
+			{"press", "s", 100, "chord s"},
+			{"release", "s", 150, ""},
+			{"press", "t", 200, "chord t"},
+			{"release", "t", 250, ""},
+			{"press", "s", 300, "chord s"},
+			{"release", "s", 350, ""},
+			{"release", "shift", 400, ""},
+		}},
+		{"shifted pad without the modifier", []chordStep{
+			{"press", "s", 0, "+s"},
+			{"release", "s", 50, "-s"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newChordMatcher()
+			m.window = 80 * time.Millisecond
+			held := pressedSet{}
+			for i, step := range test.steps {
+				b := buttons[step.button]
+				var events []chordEvent
+				switch step.action {
+				case "press":
+					held.update(b, true, ms(step.at))
+					events = m.press(b, ms(step.at), chords, held)
+				case "release":
+					held.update(b, false, ms(step.at))
+					events = m.release(b, ms(step.at))
+				case "tick":
+					events = m.tick(ms(step.at))
+				}
+				if got := describeChordEvents(events, names); got != step.want {
+					t.Errorf("step %d, %s %s at %dms: got %q, want %q", i, step.action, step.button, step.at, got, step.want)
+				}
+			}
+			if len(m.pending) != 0 || len(m.used) != 0 {
+				t.Errorf("matcher still holds %d presses and %d used buttons", len(m.pending), len(m.used))
+			}
+		})
+	}
+}
+
+func TestChordMatcherDeadline(t *testing.T) {
+	a, shift := &button{x: 0, y: 0, bType: GRID}, &button{x: 0, y: 7, bType: GRID}
+	chords := []chordBinding{
+		{button: a, with: []*button{{x: 1, y: 0, bType: GRID}}},
+		{button: &button{x: 5, y: 5, bType: GRID}, shift: shift},
+	}
+	m := newChordMatcher()
+	m.window = 80 * time.Millisecond
+
+	// a held modifier waits without a deadline
+	m.press(shift, ms(0), chords, pressedSet{shift: ms(0)})
+	if next, ok := m.deadline(); ok {
+		t.Errorf("deadline %v for a held modifier", next)
+	}
+	// a chord member is let through just after the window
+	m.press(a, ms(10), chords, pressedSet{shift: ms(0), a: ms(10)})
+	if next, ok := m.deadline(); !ok || !next.Equal(ms(90).Add(time.Nanosecond)) {
+		t.Errorf("deadline = %v, %t, want just after %v", next, ok, ms(90))
+	}
+	m.reset()
+	if _, ok := m.deadline(); ok || len(m.pending) != 0 {
+		t.Errorf("reset kept %d presses", len(m.pending))
+	}
+}
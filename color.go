@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LED color of a launchpad S, red and green intensity from 0 (off) to 3 (bright)
+type Color struct {
+	Red   uint8 // red intensity 0-3
+	Green uint8 // green intensity 0-3
+	Copy  bool  // write the color to both LED buffers
+	Clear bool  // clear the other LED buffer
+}
+
+// velocity flag bits of a launchpad S color
+const (
+	copyFlag  = 0x04
+	clearFlag = 0x08
+)
+
+// named LED colors
+var (
+	off       = Color{}
+	red       = Color{Red: 3}
+	dimRed    = Color{Red: 1}
+	green     = Color{Green: 3}
+	dimGreen  = Color{Green: 1}
+	amber     = Color{Red: 3, Green: 2}
+	lime      = Color{Red: 2, Green: 3}
+	yellow    = Color{Red: 3, Green: 3}
+	orange    = Color{Red: 3, Green: 1}
+	paleGreen = Color{Red: 1, Green: 3}
+	dimYellow = Color{Red: 1, Green: 1}
+)
+
+// default user color
+var defaultColor = amber
+
+// map of string color names to colors
+var colors = map[string]Color{
+	"off":       off,
+	"red":       red,
+	"dimred":    dimRed,
+	"green":     green,
+	"dimgreen":  dimGreen,
+	"amber":     amber,
+	"lime":      lime,
+	"yellow":    yellow,
+	"orange":    orange,
+	"palegreen": paleGreen,
+	"dimyellow": dimYellow,
+}
+
+// function to encode the color as a launchpad S velocity byte
+func (c Color) velocity() byte {
+	v := c.Green<<4 | c.Red
+	if c.Copy {
+		v |= copyFlag
+	}
+	if c.Clear {
+		v |= clearFlag
+	}
+	return v
+}
+
+// function to decode a launchpad S velocity byte
+func velocityColor(v byte) Color {
+	return Color{Red: v & 0x03, Green: (v >> 4) & 0x03, Copy: v&copyFlag != 0, Clear: v&clearFlag != 0}
+}
+
+// function to get the color without the copy and clear flags
+func (c Color) plain() Color {
+	return Color{Red: c.Red, Green: c.Green}
+}
+
+// function to check if the color lights the LED
+func (c Color) isOff() bool {
+	return c.Red == 0 && c.Green == 0
+}
+
+// function to format the color as its name, or as "r3g1" when it has none
+func (c Color) String() string {
+	if c == off {
+		return "off"
+	}
+	for _, name := range []string{"red", "green", "amber", "lime", "yellow", "orange", "palegreen", "dimred", "dimgreen", "dimyellow"} {
+		if colors[name] == c {
+			return name
+		}
+	}
+	s := fmt.Sprintf("r%dg%d", c.Red, c.Green)
+	if c.Copy {
+		s += "c"
+	}
+	if c.Clear {
+		s += "x"
+	}
+	return s
+}
+
+// function to parse a color name such as "amber", an intensity pair such as "r3g1"
+// optionally followed by "c" (copy) and "x" (clear), or a launchpad S velocity number
+func parseColor(s string) (Color, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if c, ok := colors[s]; ok {
+		return c, nil
+	}
+
+	// velocity numbers as saved by older versions
+	if v, err := strconv.Atoi(s); err == nil {
+		if v < 0 || v > 0x3F {
+			return Color{}, fmt.Errorf("Color velocity out of range: %d", v)
+		}
+		return velocityColor(byte(v)), nil
+	}
+
+	// intensity pair with optional flags
+	var c Color
+	if len(s) < 4 || s[0] != 'r' || s[2] != 'g' {
+		return Color{}, fmt.Errorf("Unknown color: %s", s)
+	}
+	r, g := s[1]-'0', s[3]-'0'
+	if r > 3 || g > 3 {
+		return Color{}, fmt.Errorf("Color intensity out of range 0-3: %s", s)
+	}
+	c.Red, c.Green = r, g
+	for _, flag := range s[4:] {
+		switch flag {
+		case 'c':
+			c.Copy = true
+		case 'x':
+			c.Clear = true
+		default:
+			return Color{}, fmt.Errorf("Unknown color flag %c in %s", flag, s)
+		}
+	}
+	return c, nil
+}
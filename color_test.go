@@ -0,0 +1,113 @@
+package main
+
+import "testing"
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Color
+		err  string
+	}{
+		// names, in any case and with spaces around them
+		{in: "off", want: off},
+		{in: "amber", want: amber},
+		{in: " PaleGreen ", want: paleGreen},
+		{in: "dimyellow", want: dimYellow},
+
+		// intensity pairs with the copy and clear flags
+		{in: "r3g1", want: orange},
+		{in: "r0g0", want: off},
+		{in: "r1g2c", want: Color{Red: 1, Green: 2, Copy: true}},
+		{in: "r2g0x", want: Color{Red: 2, Clear: true}},
+		{in: "R3G3XC", want: Color{Red: 3, Green: 3, Copy: true, Clear: true}},
+
+		// velocities saved by older versions
+		{in: "0", want: off},
+		{in: "3", want: red},
+		{in: "51", want: yellow},
+		{in: "15", want: Color{Red: 3, Copy: true, Clear: true}},
+		{in: "63", want: Color{Red: 3, Green: 3, Copy: true, Clear: true}},
+
+		{in: "64", err: "Color velocity out of range: 64"},
+		{in: "-1", err: "Color velocity out of range: -1"},
+		{in: "r4g0", err: "Color intensity out of range 0-3: r4g0"},
+		{in: "r0g9", err: "Color intensity out of range 0-3: r0g9"},
+		{in: "r-g1", err: "Color intensity out of range 0-3: r-g1"},
+		{in: "r3g1z", err: "Unknown color flag z in r3g1z"},
+		{in: "r3g", err: "Unknown color: r3g"},
+		{in: "g1r3", err: "Unknown color: g1r3"},
+		{in: "purple", err: "Unknown color: purple"},
+		{in: "", err: "Unknown color: "},
+	}
+	for _, test := range tests {
+		got, err := parseColor(test.in)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("parseColor(%q) returned %v, want %q", test.in, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("parseColor(%q) = %#v, %v, want %#v", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestColorVelocity(t *testing.T) {
+	tests := []struct {
+		color Color
+		want  byte
+	}{
+		{off, 0x00},
+		{red, 0x03},
+		{green, 0x30},
+		{amber, 0x23},
+		{Color{Red: 1, Copy: true}, 0x05},
+		{Color{Green: 1, Clear: true}, 0x18},
+		{Color{Red: 3, Green: 3, Copy: true, Clear: true}, 0x3F},
+	}
+	for _, test := range tests {
+		if got := test.color.velocity(); got != test.want {
+			t.Errorf("%v.velocity() = %#02x, want %#02x", test.color, got, test.want)
+		}
+		if got := velocityColor(test.want); got != test.color {
+			t.Errorf("velocityColor(%#02x) = %v, want %v", test.want, got, test.color)
+		}
+	}
+}
+
+func TestColorString(t *testing.T) {
+	tests := []struct {
+		color Color
+		want  string
+	}{
+		{off, "off"},
+		{orange, "orange"},
+		{dimRed, "dimred"},
+		{Color{Red: 2}, "r2g0"},
+		{Color{Red: 3, Copy: true}, "r3g0c"},
+		{Color{Green: 1, Clear: true}, "r0g1x"},
+		{Color{Red: 3, Green: 3, Copy: true, Clear: true}, "r3g3cx"},
+	}
+	for _, test := range tests {
+		if got := test.color.String(); got != test.want {
+			t.Errorf("%#v.String() = %q, want %q", test.color, got, test.want)
+		}
+	}
+
+	// every color a velocity can hold survives being saved and read back
+	for v := range 0x40 {
+		c := velocityColor(byte(v))
+		got, err := parseColor(c.String())
+		if err != nil || got != c {
+			t.Errorf("parseColor(%q) = %v, %v, want %#v", c.String(), got, err, c)
+		}
+	}
+
+	// every name formats as itself
+	for name, c := range colors {
+		if c.String() != name {
+			t.Errorf("%s formats as %s", name, c)
+		}
+	}
+}
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version of the macro config format written by this program
+const configVersion = 1
+
+// built in action undoing the last save of the macro config
+const undoAction = "undo"
+
+// function to check the name of a built in action
+func validAction(name string) bool {
+	switch name {
+	case undoAction:
+		return true
+	}
+	return false
+}
+
+// macro config of one launchpad
+type macroConfig struct {
+	version   int
+	layers    []string      // layer name of each top row button, nil for the default layers
+	onExit    string        // exitWait or exitKill, empty for the default
+	longPress time.Duration // hold time of a long press, 0 for the default
+	doubleTap time.Duration // longest time between the taps of a double tap, 0 for the default
+	chordTime time.Duration // time in which the buttons of a chord must all be pressed, 0 for the default
+	pads      []padConfig
+	tops      []topConfig
+	automata  map[string]automatonConfig // settings of automaton layers by layer name, from tables such as [life]
+}
+
+// macro bound to a grid pad
+type padConfig struct {
+	page     int             // macro page 0-7, picked with the right column
+	row      int             // grid row 0-7, top to bottom
+	col      int             // grid column 0-7, left to right
+	cmd      string          // command run through the shell
+	action   string          // built in action run instead of a command
+	gestures gestureCommands // commands run by a double tap, long press or release
+	toggle   toggleCommands  // on and off commands run in turn instead of cmd
+	with     []buttonPos     // buttons pressed together with the pad to run this macro instead
+	shift    *buttonPos      // modifier held down while the pad is pressed to run this macro instead
+	color    Color           // LED color of the pad in the macro layer
+	label    string          // short description of the macro
+	shell    string          // shell overriding the default
+	dir      string          // working directory overriding the default
+	env      []string        // extra environment in KEY=value format
+	timeout  time.Duration   // time limit overriding the default
+}
+
+// action bound to a top row button, which then no longer switches layers
+type topConfig struct {
+	col    int    // top row button 0-7, left to right
+	action string // built in action
+}
+
+// function to read and validate a macro config file
+func loadConfig(path string) (*macroConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading macro config: %v", err)
+	}
+	cfg, err := parseConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error in macro config %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// function to parse and validate macro config text
+func parseConfig(data string) (*macroConfig, error) {
+	doc, err := parseToml(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// check the format version
+	cfg := &macroConfig{}
+	version, ok, err := doc.root.integer("version")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &tomlError{1, "missing version"}
+	}
+	if version < 1 || version > configVersion {
+		return nil, &tomlError{doc.root.lineOf("version"), fmt.Sprintf("unsupported config version %d, this program reads version %d", version, configVersion)}
+	}
+	cfg.version = version
+
+	// top row layers, empty names leave a button unused
+	layers, ok, err := doc.root.strings("layers")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		line := doc.root.lineOf("layers")
+		if len(layers) > 8 {
+			return nil, &tomlError{line, fmt.Sprintf("%d layers given, the top row has 8 buttons", len(layers))}
+		}
+		used := false
+		for _, name := range layers {
+			if name != "" && !validLayer(name) {
+				return nil, &tomlError{line, fmt.Sprintf("unknown layer %q", name)}
+			}
+			used = used || name != ""
+		}
+		if !used {
+			return nil, &tomlError{line, "layers needs at least one layer"}
+		}
+		cfg.layers = layers
+	}
+
+	// what happens to running macros on exit
+	if cfg.onExit, ok, err = doc.root.str("on_exit"); err != nil {
+		return nil, err
+	}
+	if ok && cfg.onExit != exitWait && cfg.onExit != exitKill {
+		return nil, &tomlError{doc.root.lineOf("on_exit"), fmt.Sprintf("unknown on_exit %q, it must be %q or %q", cfg.onExit, exitWait, exitKill)}
+	}
+	// gesture and chord times
+	for _, setting := range []struct {
+		key   string
+		value *time.Duration
+	}{{"long_press_time", &cfg.longPress}, {"double_tap_time", &cfg.doubleTap}, {"chord_time", &cfg.chordTime}} {
+		s, ok, err := doc.root.str(setting.key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if *setting.value, err = time.ParseDuration(s); err != nil || *setting.value <= 0 {
+			return nil, &tomlError{doc.root.lineOf(setting.key), fmt.Sprintf("invalid %s %q, use a duration such as \"500ms\"", setting.key, s)}
+		}
+	}
+
+	if err := doc.root.unknownKeys(); err != nil {
+		return nil, err
+	}
+	// only automaton layer tables such as [life], [[pad]] and [[top]] tables are known
+	for name, t := range doc.tables {
+		if _, ok := defaultAutomata[name]; !ok {
+			return nil, &tomlError{t.line, fmt.Sprintf("unknown table [%s]", name)}
+		}
+		automaton, err := parseAutomaton(name, t)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.automata == nil {
+			cfg.automata = map[string]automatonConfig{}
+		}
+		cfg.automata[name] = automaton
+	}
+
+	for name, tables := range doc.arrays {
+		if name != "pad" && name != "top" {
+			return nil, &tomlError{tables[0].line, fmt.Sprintf("unknown table [[%s]]", name)}
+		}
+	}
+
+	// read the pads, each pad, chord and shifted pad may only be bound once per page
+	bound := map[string]int{}
+	for _, t := range doc.arrays["pad"] {
+		pad, err := parsePad(t)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%d %s", pad.page, pad.binding())
+		if line, ok := bound[key]; ok {
+			return nil, &tomlError{t.line, fmt.Sprintf("%s of page %d is already bound on line %d", pad.binding(), pad.page, line)}
+		}
+		bound[key] = t.line
+		cfg.pads = append(cfg.pads, pad)
+	}
+
+	// read the top row actions
+	boundTop := map[int]int{}
+	for _, t := range doc.arrays["top"] {
+		top, err := parseTop(t)
+		if err != nil {
+			return nil, err
+		}
+		if line, ok := boundTop[top.col]; ok {
+			return nil, &tomlError{t.line, fmt.Sprintf("top button %d is already bound on line %d", top.col, line)}
+		}
+		boundTop[top.col] = t.line
+		cfg.tops = append(cfg.tops, top)
+	}
+	return cfg, nil
+}
+
+// function to read the table of an automaton layer, missing keys keep the layer's defaults
+func parseAutomaton(name string, t *tomlTable) (automatonConfig, error) {
+	automaton := defaultAutomata[name]
+	if rule, ok, err := t.str("rule"); err != nil {
+		return automaton, err
+	} else if ok {
+		r, err := parseRule(rule)
+		if err != nil {
+			return automaton, &tomlError{t.lineOf("rule"), err.Error()}
+		}
+		automaton.rule = r.String()
+	}
+	if wrap, ok, err := t.boolean("wrap"); err != nil {
+		return automaton, err
+	} else if ok {
+		automaton.wrap = wrap
+	}
+
+	// cell colors by age
+	if names, ok, err := t.strings("colors"); err != nil {
+		return automaton, err
+	} else if ok {
+		if len(names) == 0 {
+			return automaton, &tomlError{t.lineOf("colors"), "colors needs at least one color"}
+		}
+		for _, name := range names {
+			color, err := parseColor(name)
+			if err != nil {
+				return automaton, &tomlError{t.lineOf("colors"), err.Error()}
+			}
+			automaton.colors = append(automaton.colors, color)
+		}
+	}
+	if name, ok, err := t.str("ant_color"); err != nil {
+		return automaton, err
+	} else if ok {
+		color, err := parseColor(name)
+		if err != nil {
+			return automaton, &tomlError{t.lineOf("ant_color"), err.Error()}
+		}
+		automaton.antColor = &color
+	}
+	return automaton, t.unknownKeys()
+}
+
+// function to read one [[top]] table
+func parseTop(t *tomlTable) (topConfig, error) {
+	var top topConfig
+	col, ok, err := t.integer("col")
+	if err != nil {
+		return top, err
+	}
+	if !ok {
+		return top, &tomlError{t.line, "top button is missing col"}
+	}
+	if col < 0 || col > 7 {
+		return top, &tomlError{t.lineOf("col"), fmt.Sprintf("top button col %d is outside the top row, it must be 0-7", col)}
+	}
+	top.col = col
+
+	if top.action, ok, err = t.str("action"); err != nil {
+		return top, err
+	}
+	if !ok {
+		return top, &tomlError{t.line, fmt.Sprintf("top button %d has no action", col)}
+	}
+	if !validAction(top.action) {
+		return top, &tomlError{t.lineOf("action"), fmt.Sprintf("unknown action %q", top.action)}
+	}
+	return top, t.unknownKeys()
+}
+
+// function to read one [[pad]] table
+func parsePad(t *tomlTable) (padConfig, error) {
+	pad := padConfig{color: defaultColor}
+
+	// page, the first one when missing
+	if n, ok, err := t.integer("page"); err != nil {
+		return pad, err
+	} else if ok {
+		if n < 0 || n >= macroPages {
+			return pad, &tomlError{t.lineOf("page"), fmt.Sprintf("pad page %d doesn't exist, it must be 0-%d", n, macroPages-1)}
+		}
+		pad.page = n
+	}
+
+	// position, checked against the 8x8 grid
+	for _, pos := range []struct {
+		key   string
+		value *int
+	}{{"row", &pad.row}, {"col", &pad.col}} {
+		n, ok, err := t.integer(pos.key)
+		if err != nil {
+			return pad, err
+		}
+		if !ok {
+			return pad, &tomlError{t.line, fmt.Sprintf("pad is missing %s", pos.key)}
+		}
+		if n < 0 || n > 7 {
+			return pad, &tomlError{t.lineOf(pos.key), fmt.Sprintf("pad %s %d is outside the grid, it must be 0-7", pos.key, n)}
+		}
+		*pos.value = n
+	}
+
+	// command and text options
+	var err error
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{
+		{"cmd", &pad.cmd}, {"action", &pad.action}, {"label", &pad.label}, {"shell", &pad.shell}, {"dir", &pad.dir},
+		{"double_tap", &pad.gestures.doubleTap}, {"long_press", &pad.gestures.longPress}, {"release", &pad.gestures.release},
+		{"on", &pad.toggle.on}, {"off", &pad.toggle.off}, {"query", &pad.toggle.query},
+	} {
+		if *field.value, _, err = t.str(field.key); err != nil {
+			return pad, err
+		}
+	}
+	// chord buttons and the modifier of a shifted pad
+	buttons, ok, err := t.strings("with")
+	if err != nil {
+		return pad, err
+	}
+	if ok && len(buttons) == 0 {
+		return pad, &tomlError{t.lineOf("with"), "with needs at least one button"}
+	}
+	seen := map[buttonPos]bool{{pad.row, pad.col}: true}
+	for _, s := range buttons {
+		pos, err := parseButtonPos(s)
+		if err != nil {
+			return pad, &tomlError{t.lineOf("with"), err.Error()}
+		}
+		if seen[pos] {
+			return pad, &tomlError{t.lineOf("with"), fmt.Sprintf("button %s is in the chord twice", pos)}
+		}
+		seen[pos] = true
+		pad.with = append(pad.with, pos)
+	}
+	if s, ok, err := t.str("shift"); err != nil {
+		return pad, err
+	} else if ok {
+		pos, err := parseButtonPos(s)
+		if err != nil {
+			return pad, &tomlError{t.lineOf("shift"), err.Error()}
+		}
+		if pos == (buttonPos{pad.row, pad.col}) {
+			return pad, &tomlError{t.lineOf("shift"), fmt.Sprintf("pad at row %d, col %d can't be its own shift", pad.row, pad.col)}
+		}
+		pad.shift = &pos
+	}
+
+	switch {
+	case pad.with != nil && pad.shift != nil:
+		return pad, &tomlError{t.lineOf("shift"), fmt.Sprintf("pad at row %d, col %d has both with and shift", pad.row, pad.col)}
+	case (pad.with != nil || pad.shift != nil) && pad.gestures.any():
+		return pad, &tomlError{t.line, fmt.Sprintf("%s can't have gesture commands, only single pads have them", pad.binding())}
+	case pad.cmd == "" && pad.action == "" && !pad.gestures.any() && pad.toggle.on == "" && pad.toggle.off == "":
+		return pad, &tomlError{t.line, fmt.Sprintf("pad at row %d, col %d has no cmd, action, gesture command or toggle", pad.row, pad.col)}
+	case pad.cmd != "" && pad.action != "":
+		return pad, &tomlError{t.lineOf("action"), fmt.Sprintf("pad at row %d, col %d has both a cmd and an action", pad.row, pad.col)}
+	case pad.action != "" && !validAction(pad.action):
+		return pad, &tomlError{t.lineOf("action"), fmt.Sprintf("unknown action %q", pad.action)}
+	}
+
+	// color
+	if s, ok, err := t.str("color"); err != nil {
+		return pad, err
+	} else if ok {
+		if pad.color, err = parseColor(s); err != nil {
+			return pad, &tomlError{t.lineOf("color"), err.Error()}
+		}
+	}
+
+	// toggles, which have their own colors
+	if err := parseToggle(t, &pad); err != nil {
+		return pad, err
+	}
+
+	// environment
+	if pad.env, _, err = t.strings("env"); err != nil {
+		return pad, err
+	}
+	for _, kv := range pad.env {
+		if !strings.Contains(kv, "=") {
+			return pad, &tomlError{t.lineOf("env"), fmt.Sprintf("env entry %q must be in KEY=value format", kv)}
+		}
+	}
+
+	// timeout
+	if s, ok, err := t.str("timeout"); err != nil {
+		return pad, err
+	} else if ok {
+		if pad.timeout, err = time.ParseDuration(s); err != nil || pad.timeout < 0 {
+			return pad, &tomlError{t.lineOf("timeout"), fmt.Sprintf("invalid timeout %q, use a duration such as \"5s\"", s)}
+		}
+	}
+
+	return pad, t.unknownKeys()
+}
+
+// function to check the on and off commands of a pad and read their colors
+func parseToggle(t *tomlTable, pad *padConfig) error {
+	toggle := &pad.toggle
+	toggle.onColor, toggle.offColor = defaultOnColor, defaultOffColor
+	for _, key := range []struct {
+		key   string
+		value *Color
+	}{{"on_color", &toggle.onColor}, {"off_color", &toggle.offColor}} {
+		s, ok, err := t.str(key.key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if !toggle.any() {
+			return &tomlError{t.lineOf(key.key), fmt.Sprintf("pad at row %d, col %d has %s but no on and off commands", pad.row, pad.col, key.key)}
+		}
+		if *key.value, err = parseColor(s); err != nil {
+			return &tomlError{t.lineOf(key.key), err.Error()}
+		}
+	}
+
+	switch {
+	case toggle.on == "" && toggle.off == "" && toggle.query == "":
+		return nil
+	case toggle.on == "" || toggle.off == "":
+		return &tomlError{t.line, fmt.Sprintf("toggle pad at row %d, col %d needs both on and off", pad.row, pad.col)}
+	case pad.cmd != "" || pad.action != "":
+		return &tomlError{t.line, fmt.Sprintf("pad at row %d, col %d has on and off, it can't also have a cmd or action", pad.row, pad.col)}
+	case !pad.single():
+		return &tomlError{t.line, fmt.Sprintf("%s can't toggle, only single pads can", pad.binding())}
+	}
+	if _, ok := t.get("color"); ok {
+		return &tomlError{t.lineOf("color"), fmt.Sprintf("toggle pad at row %d, col %d uses on_color and off_color instead of color", pad.row, pad.col)}
+	}
+	return nil
+}
+
+// function to describe what a pad table binds, such as "pad at row 0, col 0 with 0,7"
+func (p padConfig) binding() string {
+	s := fmt.Sprintf("pad at row %d, col %d", p.row, p.col)
+	if p.shift != nil {
+		s += fmt.Sprintf(" shifted by %s", p.shift)
+	}
+	if p.with != nil {
+		// the same chord can be written on any of its pads
+		positions := append([]buttonPos{{p.row, p.col}}, p.with...)
+		slices.SortFunc(positions, func(a, b buttonPos) int {
+			return (a.row*9 + a.col) - (b.row*9 + b.col)
+		})
+		names := make([]string, len(positions))
+		for i, pos := range positions {
+			names[i] = pos.String()
+		}
+		s = "chord " + strings.Join(names, " + ")
+	}
+	return s
+}
+
+// function to check if a pad table binds the pad on its own, not in a chord or shifted
+func (p padConfig) single() bool {
+	return p.with == nil && p.shift == nil
+}
+
+// function to get the execution options of a pad, nil when it uses the defaults
+func (p padConfig) options() *execOptions {
+	if p.shell == "" && p.dir == "" && len(p.env) == 0 && p.timeout == 0 {
+		return nil
+	}
+	opts := defaultExec
+	if p.shell != "" {
+		opts.shell = p.shell
+	}
+	if p.dir != "" {
+		opts.dir = p.dir
+	}
+	if p.timeout != 0 {
+		opts.timeout = p.timeout
+	}
+	opts.env = p.env
+	return &opts
+}
+
+// first line of the macro configs this program writes
+const configHeader = "# launchpad macros, one [[pad]] per bound grid pad"
+
+// function to check if a macro config has comments written by hand, which are lost when it is written again
+func hasComments(data string) bool {
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != configHeader && strings.TrimSpace(stripComment(line)) != trimmed {
+			return true
+		}
+	}
+	return false
+}
+
+// function to format a macro config as TOML
+func (cfg *macroConfig) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", configHeader)
+	fmt.Fprintf(&b, "version = %d\n", configVersion)
+	if cfg.layers != nil {
+		fmt.Fprintf(&b, "layers = %s\n", tomlQuoteAll(cfg.layers))
+	}
+	if cfg.onExit != "" {
+		fmt.Fprintf(&b, "on_exit = %s\n", tomlQuote(cfg.onExit))
+	}
+	if cfg.longPress != 0 {
+		fmt.Fprintf(&b, "long_press_time = %s\n", tomlQuote(cfg.longPress.String()))
+	}
+	if cfg.doubleTap != 0 {
+		fmt.Fprintf(&b, "double_tap_time = %s\n", tomlQuote(cfg.doubleTap.String()))
+	}
+	if cfg.chordTime != 0 {
+		fmt.Fprintf(&b, "chord_time = %s\n", tomlQuote(cfg.chordTime.String()))
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.automata)) {
+		automaton := cfg.automata[name]
+		fmt.Fprintf(&b, "\n[%s]\n", name)
+		fmt.Fprintf(&b, "rule = %s\n", tomlQuote(automaton.rule))
+		fmt.Fprintf(&b, "wrap = %t\n", automaton.wrap)
+		if automaton.colors != nil {
+			names := make([]string, len(automaton.colors))
+			for i, color := range automaton.colors {
+				names[i] = color.String()
+			}
+			fmt.Fprintf(&b, "colors = %s\n", tomlQuoteAll(names))
+		}
+		if automaton.antColor != nil {
+			fmt.Fprintf(&b, "ant_color = %s\n", tomlQuote(automaton.antColor.String()))
+		}
+	}
+	for _, pad := range cfg.pads {
+		fmt.Fprintf(&b, "\n[[pad]]\n")
+		if pad.page != 0 {
+			fmt.Fprintf(&b, "page = %d\n", pad.page)
+		}
+		fmt.Fprintf(&b, "row = %d\n", pad.row)
+		fmt.Fprintf(&b, "col = %d\n", pad.col)
+		if pad.with != nil {
+			names := make([]string, len(pad.with))
+			for i, pos := range pad.with {
+				names[i] = pos.String()
+			}
+			fmt.Fprintf(&b, "with = %s\n", tomlQuoteAll(names))
+		}
+		if pad.shift != nil {
+			fmt.Fprintf(&b, "shift = %s\n", tomlQuote(pad.shift.String()))
+		}
+		if pad.action != "" {
+			fmt.Fprintf(&b, "action = %s\n", tomlQuote(pad.action))
+		} else if pad.cmd != "" {
+			fmt.Fprintf(&b, "cmd = %s\n", tomlQuote(pad.cmd))
+		}
+		if pad.toggle.any() {
+			fmt.Fprintf(&b, "on = %s\n", tomlQuote(pad.toggle.on))
+			fmt.Fprintf(&b, "off = %s\n", tomlQuote(pad.toggle.off))
+			if pad.toggle.query != "" {
+				fmt.Fprintf(&b, "query = %s\n", tomlQuote(pad.toggle.query))
+			}
+		}
+		for _, gesture := range []struct{ key, cmd string }{
+			{"double_tap", pad.gestures.doubleTap}, {"long_press", pad.gestures.longPress}, {"release", pad.gestures.release},
+		} {
+			if gesture.cmd != "" {
+				fmt.Fprintf(&b, "%s = %s\n", gesture.key, tomlQuote(gesture.cmd))
+			}
+		}
+		if pad.toggle.any() {
+			fmt.Fprintf(&b, "on_color = %s\n", tomlQuote(pad.toggle.onColor.String()))
+			fmt.Fprintf(&b, "off_color = %s\n", tomlQuote(pad.toggle.offColor.String()))
+		} else {
+			fmt.Fprintf(&b, "color = %s\n", tomlQuote(pad.color.String()))
+		}
+		if pad.label != "" {
+			fmt.Fprintf(&b, "label = %s\n", tomlQuote(pad.label))
+		}
+		if pad.shell != "" {
+			fmt.Fprintf(&b, "shell = %s\n", tomlQuote(pad.shell))
+		}
+		if pad.dir != "" {
+			fmt.Fprintf(&b, "dir = %s\n", tomlQuote(pad.dir))
+		}
+		if len(pad.env) > 0 {
+			fmt.Fprintf(&b, "env = %s\n", tomlQuoteAll(pad.env))
+		}
+		if pad.timeout != 0 {
+			fmt.Fprintf(&b, "timeout = %s\n", tomlQuote(pad.timeout.String()))
+		}
+	}
+	for _, top := range cfg.tops {
+		fmt.Fprintf(&b, "\n[[top]]\n")
+		fmt.Fprintf(&b, "col = %d\n", top.col)
+		fmt.Fprintf(&b, "action = %s\n", tomlQuote(top.action))
+	}
+	return b.String()
+}
+
+// function to write a macro config file, keeping a backup of the previous one
+func saveConfig(path string, cfg *macroConfig) error {
+	if err := backupFile(path); err != nil {
+		return fmt.Errorf("Error backing up macro config: %v", err)
+	}
+	if err := writeFileAtomic(path, []byte(cfg.String())); err != nil {
+		return fmt.Errorf("Error writing macro config: %v", err)
+	}
+	return nil
+}
+
+// function to read a commands.csv file from older versions
+func readLegacyMacros(path string) (*macroConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening macro file: %v", err)
+	}
+	defer file.Close()
+
+	// create new scanner
+	scanner := bufio.NewScanner(file)
+	cfg := &macroConfig{version: configVersion}
+
+	// header row
+	scanner.Scan()
+
+	// command rows, commas after the third one belong to the command
+	n := 1
+	for scanner.Scan() {
+		n++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		info := strings.SplitN(scanner.Text(), ",", 4)
+		if len(info) != 4 {
+			return nil, fmt.Errorf("%s line %d: expected row,column,color,cmd", path, n)
+		}
+		row, err := strconv.Atoi(info[0])
+		if err != nil || row < 0 || row > 7 {
+			return nil, fmt.Errorf("%s line %d: invalid row %q, it must be 0-7", path, n, info[0])
+		}
+		col, err := strconv.Atoi(info[1])
+		if err != nil || col < 0 || col > 7 {
+			return nil, fmt.Errorf("%s line %d: invalid column %q, it must be 0-7", path, n, info[1])
+		}
+		color, err := parseColor(info[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, n, err)
+		}
+		cfg.pads = append(cfg.pads, padConfig{row: row, col: col, color: color, cmd: info[3]})
+	}
+	return cfg, scanner.Err()
+}
+
+// function to convert a commands.csv file into a TOML config, the csv file is kept with a .migrated suffix
+func migrateMacros(csvPath, tomlPath string) error {
+	cfg, err := readLegacyMacros(csvPath)
+	if err != nil {
+		return fmt.Errorf("Error migrating macros: %v", err)
+	}
+	if err := saveConfig(tomlPath, cfg); err != nil {
+		return err
+	}
+	if err := os.Rename(csvPath, csvPath+".migrated"); err != nil {
+		return fmt.Errorf("Error renaming migrated macro file: %v", err)
+	}
+	slog.Info("Migrated macros", "count", len(cfg.pads), "from", csvPath, "to", tomlPath)
+	return nil
+}
+
+// function to create a macro config, migrating a commands.csv file next to it when one exists
+func createConfig(tomlPath, csvPath string) error {
+	if _, err := os.Stat(csvPath); err == nil {
+		return migrateMacros(csvPath, tomlPath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return saveConfig(tomlPath, &macroConfig{version: configVersion})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// function to make a config with one [[pad]] table, its header is on line 3 and its keys start on line 4
+func padTable(keys string) string {
+	return "version = 1\n\n[[pad]]\n" + keys
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		// document and root keys
+		{"syntax", "version = 1\ncmd\n", `line 2: expected key = value, got "cmd"`},
+		{"missing version", "layers = [\"paint\"]\n", "line 1: missing version"},
+		{"version not an integer", "version = \"1\"\n", "line 1: version must be an integer"},
+		{"unsupported version", "\nversion = 99\n", "line 2: unsupported config version 99, this program reads version 1"},
+		{"too many layers", "version = 1\nlayers = [\"paint\", \"\", \"\", \"\", \"\", \"\", \"\", \"\", \"\"]\n", "line 2: 9 layers given, the top row has 8 buttons"},
+		{"unknown layer", "version = 1\nlayers = [\"paint\", \"nope\"]\n", `line 2: unknown layer "nope"`},
+		{"no layers", "version = 1\nlayers = [\"\", \"\"]\n", "line 2: layers needs at least one layer"},
+		{"layers not an array", "version = 1\nlayers = \"paint\"\n", "line 2: layers must be an array of strings"},
+		{"unknown on_exit", "version = 1\non_exit = \"later\"\n", `line 2: unknown on_exit "later", it must be "wait" or "kill"`},
+		{"invalid long_press_time", "version = 1\nlong_press_time = \"fast\"\n", `line 2: invalid long_press_time "fast"`},
+		{"negative chord_time", "version = 1\nchord_time = \"-80ms\"\n", `line 2: invalid chord_time "-80ms"`},
+		{"zero double_tap_time", "version = 1\ndouble_tap_time = \"0s\"\n", `line 2: invalid double_tap_time "0s"`},
+		{"unknown root key", "version = 1\ncolour = \"red\"\n", `line 2: unknown key "colour" in top level`},
+		{"unknown table", "version = 1\n[paint]\n", "line 2: unknown table [paint]"},
+		{"unknown array table", "version = 1\n[[pads]]\n", "line 2: unknown table [[pads]]"},
+		{"table defined twice", "version = 1\n[life]\n[life]\n", "line 3: table [life] defined twice"},
+		{"key defined twice", "version = 1\nversion = 1\n", `line 2: key "version" defined twice`},
+
+		// automaton layers
+		{"automaton rule", "version = 1\n[life]\nrule = \"B9/S23\"\n", `line 3: rule "B9/S23" has neighbour count '9', counts are 0-8`},
+		{"automaton no colors", "version = 1\n[life]\ncolors = []\n", "line 3: colors needs at least one color"},
+		{"automaton color", "version = 1\n[life]\ncolors = [\"red\", \"pink\"]\n", "line 3: Unknown color: pink"},
+		{"automaton ant color", "version = 1\n[automaton]\nant_color = \"r4g0\"\n", "line 3: Color intensity out of range 0-3: r4g0"},
+		{"automaton wrap", "version = 1\n[life]\nwrap = \"yes\"\n", "line 3: wrap must be true or false"},
+		{"automaton unknown key", "version = 1\n[life]\nspeed = 2\n", `line 3: unknown key "speed" in [life]`},
+
+		// top row actions
+		{"top missing col", "version = 1\n[[top]]\naction = \"undo\"\n", "line 2: top button is missing col"},
+		{"top col outside the row", "version = 1\n[[top]]\ncol = 8\naction = \"undo\"\n", "line 3: top button col 8 is outside the top row"},
+		{"top without action", "version = 1\n[[top]]\ncol = 2\n", "line 2: top button 2 has no action"},
+		{"top unknown action", "version = 1\n[[top]]\ncol = 2\naction = \"redo\"\n", `line 4: unknown action "redo"`},
+		{"top bound twice", "version = 1\n[[top]]\ncol = 2\naction = \"undo\"\n[[top]]\ncol = 2\naction = \"undo\"\n", "line 5: top button 2 is already bound on line 2"},
+
+		// pads
+		{"pad page", padTable("page = 8\nrow = 0\ncol = 0\ncmd = \"true\"\n"), "line 4: pad page 8 doesn't exist, it must be 0-7"},
+		{"pad missing row", padTable("col = 0\ncmd = \"true\"\n"), "line 3: pad is missing row"},
+		{"pad col outside the grid", padTable("row = 0\ncol = 8\ncmd = \"true\"\n"), "line 5: pad col 8 is outside the grid, it must be 0-7"},
+		{"pad row with a leading zero", padTable("row = 010\ncol = 0\ncmd = \"true\"\n"), `line 4: invalid integer "010"`},
+		{"pad row not an integer", padTable("row = \"0\"\ncol = 0\ncmd = \"true\"\n"), "line 4: row must be an integer"},
+		{"pad without command", padTable("row = 0\ncol = 0\ncolor = \"red\"\n"), "line 3: pad at row 0, col 0 has no cmd, action, gesture command or toggle"},
+		{"pad cmd and action", padTable("row = 0\ncol = 0\ncmd = \"true\"\naction = \"undo\"\n"), "line 7: pad at row 0, col 0 has both a cmd and an action"},
+		{"pad unknown action", padTable("row = 0\ncol = 0\naction = \"redo\"\n"), `line 6: unknown action "redo"`},
+		{"pad color", padTable("row = 0\ncol = 0\ncmd = \"true\"\ncolor = \"pink\"\n"), "line 7: Unknown color: pink"},
+		{"pad env", padTable("row = 0\ncol = 0\ncmd = \"true\"\nenv = [\"A=1\", \"B\"]\n"), `line 7: env entry "B" must be in KEY=value format`},
+		{"pad timeout", padTable("row = 0\ncol = 0\ncmd = \"true\"\ntimeout = \"soon\"\n"), `line 7: invalid timeout "soon", use a duration such as "5s"`},
+		{"pad unknown key", padTable("row = 0\ncol = 0\ncmd = \"true\"\ncommand = \"true\"\n"), `line 7: unknown key "command" in [pad]`},
+		{"pad bound twice", padTable("row = 0\ncol = 0\ncmd = \"true\"\n\n[[pad]]\nrow = 0\ncol = 0\ncmd = \"false\"\n"), "line 8: pad at row 0, col 0 of page 0 is already bound on line 3"},
+
+		// chords and shifted pads
+		{"chord without buttons", padTable("row = 0\ncol = 0\nwith = []\ncmd = \"true\"\n"), "line 6: with needs at least one button"},
+		{"chord button outside the grid", padTable("row = 0\ncol = 0\nwith = [\"0,9\"]\ncmd = \"true\"\n"), `line 6: pad "0,9" is outside the grid`},
+		{"chord button twice", padTable("row = 0\ncol = 0\nwith = [\"0,1\", \"0,1\"]\ncmd = \"true\"\n"), "line 6: button 0,1 is in the chord twice"},
+		{"chord with its own pad", padTable("row = 0\ncol = 0\nwith = [\"0,0\"]\ncmd = \"true\"\n"), "line 6: button 0,0 is in the chord twice"},
+		{"chord bound twice", padTable("row = 0\ncol = 0\nwith = [\"0,1\"]\ncmd = \"true\"\n\n[[pad]]\nrow = 0\ncol = 1\nwith = [\"0,0\"]\ncmd = \"true\"\n"), "line 9: chord 0,0 + 0,1 of page 0 is already bound on line 3"},
+		{"shift button", padTable("row = 0\ncol = 0\nshift = \"right 8\"\ncmd = \"true\"\n"), `line 6: right column button "right 8" doesn't exist`},
+		{"shift itself", padTable("row = 0\ncol = 0\nshift = \"0,0\"\ncmd = \"true\"\n"), "line 6: pad at row 0, col 0 can't be its own shift"},
+		{"with and shift", padTable("row = 0\ncol = 0\nwith = [\"0,1\"]\nshift = \"7,7\"\ncmd = \"true\"\n"), "line 7: pad at row 0, col 0 has both with and shift"},
+		{"shifted pad with gestures", padTable("row = 0\ncol = 0\nshift = \"7,7\"\nlong_press = \"true\"\n"), "line 3: pad at row 0, col 0 shifted by 7,7 can't have gesture commands"},
+
+		// toggles
+		{"toggle color without toggle", padTable("row = 0\ncol = 0\ncmd = \"true\"\non_color = \"green\"\n"), "line 7: pad at row 0, col 0 has on_color but no on and off commands"},
+		{"toggle without off", padTable("row = 0\ncol = 0\non = \"true\"\n"), "line 3: toggle pad at row 0, col 0 needs both on and off"},
+		{"toggle query alone", padTable("row = 0\ncol = 0\ncmd = \"true\"\nquery = \"true\"\n"), "line 3: toggle pad at row 0, col 0 needs both on and off"},
+		{"toggle with cmd", padTable("row = 0\ncol = 0\ncmd = \"true\"\non = \"true\"\noff = \"true\"\n"), "line 3: pad at row 0, col 0 has on and off, it can't also have a cmd or action"},
+		{"toggle chord", padTable("row = 0\ncol = 0\nwith = [\"0,1\"]\non = \"true\"\noff = \"true\"\n"), "line 3: chord 0,0 + 0,1 can't toggle, only single pads can"},
+		{"toggle with color", padTable("row = 0\ncol = 0\non = \"true\"\noff = \"true\"\ncolor = \"red\"\n"), "line 8: toggle pad at row 0, col 0 uses on_color and off_color instead of color"},
+		{"toggle on_color", padTable("row = 0\ncol = 0\non = \"true\"\noff = \"true\"\non_color = \"pink\"\n"), "line 8: Unknown color: pink"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseConfig(test.config); err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("parseConfig returned %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	// a saved config reads back the same, so the editor doesn't lose anything
+	cfg, err := parseConfig(`version = 1
+layers = ["paint", "", "macro"]
+on_exit = "kill"
+long_press_time = "700ms"
+chord_time = "100ms"
+
+[life]
+rule = "ant"
+colors = ["red", "r1g1"]
+
+[[top]]
+col = 7
+action = "undo"
+
+[[pad]]
+page = 2
+row = 3
+col = 4
+cmd = "notify-send \"say \\\"hi\\\"\" # not a comment"
+color = "r2g1c"
+label = "#1"
+env = ["A=1", "B=x,y"]
+timeout = "5s"
+
+[[pad]]
+row = 0
+col = 0
+with = ["0,1", "right 2"]
+action = "undo"
+
+[[pad]]
+row = 1
+col = 1
+on = "pactl set-sink-mute @DEFAULT_SINK@ 1"
+off = "pactl set-sink-mute @DEFAULT_SINK@ 0"
+query = "pactl get-sink-mute @DEFAULT_SINK@ | grep -q yes"
+on_color = "amber"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := cfg.String()
+	again, err := parseConfig(saved)
+	if err != nil {
+		t.Fatalf("Error reading a saved config: %v\n%s", err, saved)
+	}
+	if again.String() != saved {
+		t.Errorf("config changed after saving it again\nfirst:\n%s\nsecond:\n%s", saved, again.String())
+	}
+	if got := again.pads[0].cmd; got != `notify-send "say \"hi\"" # not a comment` {
+		t.Errorf("cmd = %q after saving", got)
+	}
+}
+
+func TestHasComments(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"version = 1\n", false},
+		{configHeader + "\nversion = 1\n", false},
+		{"version = 1\ncmd = \"echo '#1' # not a comment\"\n", false},
+		{"# my macros\nversion = 1\n", true},
+		{"version = 1 # the format\n", true},
+		{"version = 1\n\n[[pad]]\n  # mute\nrow = 0\n", true},
+	}
+	for _, test := range tests {
+		if got := hasComments(test.data); got != test.want {
+			t.Errorf("hasComments(%q) = %t, want %t", test.data, got, test.want)
+		}
+	}
+
+	// configs this program writes have no comments of their own
+	cfg, err := parseConfig(padTable("row = 0\ncol = 0\ncmd = \"echo # hi\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasComments(cfg.String()) {
+		t.Errorf("written config has comments:\n%s", cfg.String())
+	}
+}
+
+func TestReadLegacyMacros(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.csv")
+	csv := "row,column,color,cmd\n" +
+		"0,0,red,echo a,b,c\n" +
+		"\n" +
+		"7,7,3,awk -F, '{print $1}' file.csv\n" +
+		"1,2,r1g2,notify-send \"x, y\"\n"
+	if err := os.WriteFile(path, []byte(csv), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := readLegacyMacros(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// commas after the color belong to the command
+	want := []padConfig{
+		{row: 0, col: 0, color: red, cmd: "echo a,b,c"},
+		{row: 7, col: 7, color: velocityColor(3), cmd: "awk -F, '{print $1}' file.csv"},
+		{row: 1, col: 2, color: Color{Red: 1, Green: 2}, cmd: `notify-send "x, y"`},
+	}
+	if len(cfg.pads) != len(want) {
+		t.Fatalf("read %d pads, want %d", len(cfg.pads), len(want))
+	}
+	for i, pad := range cfg.pads {
+		if pad.row != want[i].row || pad.col != want[i].col || pad.color != want[i].color || pad.cmd != want[i].cmd {
+			t.Errorf("pad %d = row %d, col %d, color %v, cmd %q, want row %d, col %d, color %v, cmd %q",
+				i, pad.row, pad.col, pad.color, pad.cmd, want[i].row, want[i].col, want[i].color, want[i].cmd)
+		}
+	}
+}
+
+func TestReadLegacyMacrosErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"0,0,red", "line 2: expected row,column,color,cmd"},
+		{"8,0,red,true", `line 2: invalid row "8", it must be 0-7`},
+		{"0,x,red,true", `line 2: invalid column "x", it must be 0-7`},
+		{"0,0,pink,true", "line 2: Unknown color: pink"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "commands.csv")
+		if err := os.WriteFile(path, []byte("row,column,color,cmd\n"+test.line+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readLegacyMacros(path); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("reading %q returned %v, want %q", test.line, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// path of the control socket, changed by the -socket flag, empty disables it
+var controlSocket = defaultSocket()
+
+// time a control connection may take to send its request and read the reply
+const controlTimeout = 5 * time.Second
+
+// request sent to the control socket, one per connection
+type controlRequest struct {
+	Command string   `json:"command"`          // devices, layer, macros, color or run
+	Device  string   `json:"device,omitempty"` // launchpad id, may be left out with one launchpad
+	Args    []string `json:"args,omitempty"`   // command arguments
+}
+
+// reply to a control request
+type controlResponse struct {
+	Lines []string `json:"lines,omitempty"` // output printed by the client
+	Error string   `json:"error,omitempty"` // reason the request failed
+}
+
+// control request waiting for a launchpad's main loop
+type controlCall struct {
+	req   controlRequest
+	reply chan controlResponse
+}
+
+// function to get the control socket path in the user's runtime directory
+func defaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "launchpad.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("launchpad-%d.sock", os.Getuid()))
+}
+
+// function to accept control requests for the launchpads, closing the listener removes the socket
+func serveControl(path string, lps []*launchpad) (net.Listener, error) {
+	// a socket left behind by a crashed instance is replaced, a live one belongs to another instance
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("Another instance is listening on %s", path)
+	}
+	os.Remove(path)
+
+	// create the socket readable by its owner only, changing its mode afterwards would leave
+	// a moment where other users can connect. Files created meanwhile only end up stricter.
+	mask := syscall.Umask(0177)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating control socket: %v", err)
+	}
+	slog.Info("Listening for control requests", "socket", path)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("Error accepting control connection", "err", err)
+				}
+				return
+			}
+			go handleControl(conn, lps)
+		}
+	}()
+	return listener, nil
+}
+
+// function to answer one control connection
+func handleControl(conn net.Conn, lps []*launchpad) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	var req controlRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		slog.Warn("Invalid control request", "err", err)
+		return
+	}
+	slog.Debug("Control request", "command", req.Command, "device", req.Device, "args", req.Args)
+	resp := dispatchControl(req, lps)
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		slog.Warn("Error answering control request", "err", err)
+	}
+}
+
+// function to pass a control request to the launchpad it is meant for
+func dispatchControl(req controlRequest, lps []*launchpad) controlResponse {
+	// the device list doesn't need a main loop
+	if req.Command == "devices" {
+		var resp controlResponse
+		for _, lp := range lps {
+			resp.Lines = append(resp.Lines, fmt.Sprintf("%s\t%s\t%s", lp.device.id, lp.profile.name(), lp.device.name))
+		}
+		return resp
+	}
+
+	// pick the launchpad
+	var lp *launchpad
+	for _, l := range lps {
+		if req.Device == "" || l.device.id == req.Device {
+			if lp != nil {
+				return controlResponse{Error: "several launchpads are connected, pick one with -device"}
+			}
+			lp = l
+		}
+	}
+	if lp == nil {
+		return controlResponse{Error: fmt.Sprintf("no launchpad %q", req.Device)}
+	}
+
+	// the main loop owns the state, wait for its answer
+	call := &controlCall{req: req, reply: make(chan controlResponse, 1)}
+	lp.post(event{kind: controlEvent, control: call})
+	select {
+	case resp := <-call.reply:
+		return resp
+	case <-lp.ctx.Done():
+		return controlResponse{Error: "launchpad is shutting down"}
+	}
+}
+
+// function to run a control request in the main loop
+func (lp *launchpad) control(req controlRequest, current Layer) controlResponse {
+	switch req.Command {
+	case "layer":
+		return controlResponse{Lines: []string{fmt.Sprintf("%d\t%s", lp.layer, current.Name())}}
+
+	case "macros":
+		var resp controlResponse
+		for page := range lp.pages {
+			for row := range lp.pages[page] {
+				for col, m := range lp.pages[page][row] {
+					if !m.bound() {
+						continue
+					}
+					what, color := m.cmd, m.color
+					if m.action != "" {
+						what = "action " + m.action
+					}
+					if m.toggle.any() {
+						on := lp.toggles[[3]int{page, row, col}]
+						state := "off"
+						if on {
+							state = "on"
+						}
+						what = fmt.Sprintf("toggle %s, on: %s, off: %s", state, m.toggle.on, m.toggle.off)
+						color = m.toggle.color(on)
+					}
+					line := fmt.Sprintf("%d\t%d\t%d\t%s\t%s", page, row, col, color, what)
+					if m.label != "" {
+						line += "\t# " + m.label
+					}
+					resp.Lines = append(resp.Lines, line)
+				}
+			}
+			// chords and shifted pads, after the pads of their page
+			for _, c := range lp.chords[page] {
+				what := c.macro.cmd
+				if c.macro.action != "" {
+					what = "action " + c.macro.action
+				}
+				if c.shift != nil {
+					what = fmt.Sprintf("shift %s: %s", c.shift.pos(), what)
+				}
+				if c.with != nil {
+					with := make([]string, len(c.with))
+					for i, b := range c.with {
+						with[i] = b.pos().String()
+					}
+					what = fmt.Sprintf("with %s: %s", strings.Join(with, " + "), what)
+				}
+				line := fmt.Sprintf("%d\t%d\t%d\t%s\t%s", page, c.button.y, c.button.x, c.macro.color, what)
+				if c.macro.label != "" {
+					line += "\t# " + c.macro.label
+				}
+				resp.Lines = append(resp.Lines, line)
+			}
+		}
+		return resp
+
+	case "color":
+		if len(req.Args) != 3 {
+			return controlResponse{Error: "usage: color ROW COL COLOR"}
+		}
+		b, err := lp.controlPad(req.Args[0], req.Args[1])
+		if err != nil {
+			return controlResponse{Error: err.Error()}
+		}
+		color, err := parseColor(req.Args[2])
+		if err != nil {
+			return controlResponse{Error: err.Error()}
+		}
+		if err := b.ledOn(color); err != nil {
+			return controlResponse{Error: err.Error()}
+		}
+		return controlResponse{}
+
+	case "run":
+		if len(req.Args) != 2 && len(req.Args) != 3 {
+			return controlResponse{Error: "usage: run ROW COL [PAGE]"}
+		}
+		b, err := lp.controlPad(req.Args[0], req.Args[1])
+		if err != nil {
+			return controlResponse{Error: err.Error()}
+		}
+		page := lp.page
+		if len(req.Args) == 3 {
+			if page, err = strconv.Atoi(req.Args[2]); err != nil || page < 0 || page >= macroPages {
+				return controlResponse{Error: fmt.Sprintf("invalid page %q, it must be 0-%d", req.Args[2], macroPages-1)}
+			}
+		}
+
+		// run the pad's macro from the requested page without showing that page
+		m := lp.pages[page][b.y][b.x]
+		if !m.bound() {
+			return controlResponse{Error: fmt.Sprintf("no macro at row %d, col %d of page %d", b.y, b.x, page)}
+		}
+		pad := *b
+		pad.bind(m)
+		if m.action != "" {
+			go lp.runAction(&pad, m.action)
+			return controlResponse{}
+		}
+		if m.toggle.any() {
+			err = lp.toggle(&pad, page)
+		} else {
+			err = pad.execute(lp.runs)
+		}
+		if err != nil {
+			return controlResponse{Error: err.Error()}
+		}
+		return controlResponse{}
+	}
+	return controlResponse{Error: fmt.Sprintf("unknown command %q", req.Command)}
+}
+
+// function to find the grid button of a row and column given as text
+func (lp *launchpad) controlPad(row, col string) (*button, error) {
+	r, err := strconv.Atoi(row)
+	if err != nil || r < 0 || r > 7 {
+		return nil, fmt.Errorf("invalid row %q, it must be 0-7", row)
+	}
+	c, err := strconv.Atoi(col)
+	if err != nil || c < 0 || c > 7 {
+		return nil, fmt.Errorf("invalid col %q, it must be 0-7", col)
+	}
+	return lp.gridButtons[r][c], nil
+}
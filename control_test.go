@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestServeControlSocket(t *testing.T) {
+	mask := syscall.Umask(022)
+	t.Cleanup(func() {
+		syscall.Umask(mask)
+	})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "launchpad.sock")
+
+	// the socket is only ever accessible to its owner
+	listener, err := serveControl(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode %v, want a socket with 0600", info.Mode())
+	}
+
+	// the umask is put back for files created later
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "file")); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("file created after the socket has mode %v, %v, want 0644", info.Mode().Perm(), err)
+	}
+
+	// a second instance doesn't take over the socket
+	if _, err := serveControl(path, nil); err == nil || !strings.Contains(err.Error(), "Another instance") {
+		t.Errorf("second serveControl returned %v, want another instance", err)
+	}
+
+	// closing removes the socket
+	listener.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket left behind after closing: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// function to run "launchpad ctl", which sends one request to a running instance and prints the reply
+func runCtl(args []string) int {
+	flags := flag.NewFlagSet("ctl", flag.ExitOnError)
+	socket := flags.String("socket", controlSocket, "control socket of the running instance")
+	device := flags.String("device", "", "id of the launchpad, needed when several are connected")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), `Usage: launchpad ctl [flags] COMMAND [ARGS]
+
+Commands:
+  devices               list the connected launchpads
+  layer                 show the current layer
+  macros                list the macros as page, row, col, color and command
+  color ROW COL COLOR   light a grid pad
+  run ROW COL [PAGE]    run the macro of a grid pad
+
+Flags:
+`)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	// send the request
+	conn, err := net.DialTimeout("unix", *socket, controlTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to launchpad: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+	req := controlRequest{Command: flags.Arg(0), Device: *device, Args: flags.Args()[1:]}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		fmt.Fprintf(os.Stderr, "Error sending request: %v\n", err)
+		return 1
+	}
+
+	// print the reply
+	var resp controlResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading reply: %v\n", err)
+		return 1
+	}
+	for _, line := range resp.Lines {
+		fmt.Println(line)
+	}
+	if resp.Error != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", resp.Error)
+		return 1
+	}
+	return 0
+}
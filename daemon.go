@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"os"
+)
+
+// function to set up logging, daemons log key=value lines to stderr without
+// timestamps since the journal adds its own
+func setupLogging(daemon, debug bool) {
+	level := slog.LevelInfo
+	if debug {
+		level = slog.LevelDebug
+	}
+	if !daemon {
+		// the default handler writes through the log package
+		slog.SetLogLoggerLevel(level)
+		return
+	}
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	slog.SetDefault(slog.New(handler))
+}
+
+// function to tell systemd about the service state such as "READY=1",
+// nothing is sent when not started by systemd with Type=notify
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	// names starting with @ are abstract sockets, which net handles itself
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// launchpad found in the midi device list
+type midiDevice struct {
+	port string // amidi port in format "hw:x,x,x"
+	name string // midi device name such as "Launchpad S MIDI 1"
+	id   string // USB serial, or ALSA card name when the device has no serial
+}
+
+// function to list every connected launchpad
+func listDevices() ([]midiDevice, error) {
+	// the simulator stands in for a single launchpad
+	if transportName == simName {
+		return []midiDevice{{name: "Simulated Launchpad", id: simName}}, nil
+	}
+
+	// list midi devices
+	cmd := exec.Command(lpCmd, "-l")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Error listing midi devices: %v", err)
+	}
+
+	// iterate through lines containing 'Launchpad', in format "IO  hw:1,0,0  Launchpad S MIDI 1"
+	var devices []midiDevice
+	for line := range strings.SplitSeq(string(out), "\n") {
+		if !strings.Contains(line, "Launchpad") {
+			continue
+		}
+		// the X's DAW port is for software like Ableton, its MIDI port is used instead
+		if strings.Contains(line, "DAW") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[1], "hw:") {
+			continue
+		}
+		dev := midiDevice{port: fields[1], name: strings.Join(fields[2:], " ")}
+		dev.id = deviceID(dev.port)
+		devices = append(devices, dev)
+	}
+
+	// error if not found
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("Could not find a launchpad in midi devices: %s", out)
+	}
+	return devices, nil
+}
+
+// function to find a connected launchpad by id
+func findDevice(id string) (midiDevice, error) {
+	devices, err := listDevices()
+	if err != nil {
+		return midiDevice{}, err
+	}
+	for _, dev := range devices {
+		if dev.id == id {
+			return dev, nil
+		}
+	}
+	return midiDevice{}, fmt.Errorf("Could not find launchpad: %s", id)
+}
+
+// function to get a stable id for the device on a port, preferring the USB serial
+func deviceID(port string) string {
+	card, err := cardPath(port)
+	if err != nil {
+		return port
+	}
+	// USB devices expose their serial on the parent of the sound card's interface
+	number := strings.TrimPrefix(card, "/proc/asound/card")
+	if iface, err := filepath.EvalSymlinks("/sys/class/sound/card" + number + "/device"); err == nil {
+		if serial, err := os.ReadFile(filepath.Join(iface, "..", "serial")); err == nil {
+			if s := strings.TrimSpace(string(serial)); s != "" {
+				return s
+			}
+		}
+	}
+	// otherwise use the ALSA card name such as "S" or "S_1"
+	if name, err := os.ReadFile(card + "/id"); err == nil {
+		return strings.TrimSpace(string(name))
+	}
+	return port
+}
+
+// function to find / create the macro file of a device, new devices start from the shared macro file
+func deviceMacroFile(id string) (string, error) {
+	dir := filepath.Join(macroDir, "devices", id)
+	path := filepath.Join(dir, macroFileName())
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return path, err
+	}
+
+	// create the directory
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", fmt.Errorf("Error creating device config directory: %v", err)
+	}
+
+	// migrate the device's macros from older versions
+	legacy := filepath.Join(dir, legacyMacroFile)
+	if _, err := os.Stat(legacy); err == nil {
+		return path, migrateMacros(legacy, path)
+	}
+
+	// copy the shared macros
+	macros, err := os.ReadFile(macroFile)
+	if err != nil {
+		return "", fmt.Errorf("Error reading macro file: %v", err)
+	}
+	if err := writeFileAtomic(path, macros); err != nil {
+		return "", fmt.Errorf("Error creating device macro file: %v", err)
+	}
+	slog.Info("Created macro file", "device", id, "file", path)
+	return path, nil
+}
+
+// function to get the file name of the shared macro file
+func macroFileName() string {
+	return filepath.Base(macroFile)
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// terminal opened by the record layer to run the macro editor, changed by the -terminal flag
+var editTerminal = defaultTerminal()
+
+// keys sent by the terminal
+const (
+	keyUp     = "\x1b[A"
+	keyDown   = "\x1b[B"
+	keyRight  = "\x1b[C"
+	keyLeft   = "\x1b[D"
+	keyHome   = "\x1b[H"
+	keyEnd    = "\x1b[F"
+	keyDelete = "\x1b[3~"
+	keyEscape = "\x1b"
+	keyEnter  = "\r"
+	keyCtrlC  = "\x03"
+)
+
+// screen row of the status line, which also holds text being edited
+const statusRow = 19
+
+// full screen terminal editor for the macros of one launchpad
+type editor struct {
+	path     string       // macro config being edited
+	cfg      *macroConfig // config with the unsaved changes
+	saved    []byte       // file contents when loaded or last saved
+	page     int          // shown macro page
+	row, col int          // selected pad
+	color    Color        // color of new pads
+	dirty    bool         // there are unsaved changes
+	quitting bool         // quit was pressed with unsaved changes
+	comments bool         // the file has comments written by hand, saving asks once before dropping them
+	status   string       // message shown under the grid
+	in       *bufio.Reader
+	out      *bufio.Writer
+}
+
+// function to get the terminal command the editor is run in, from $TERMINAL when set
+func defaultTerminal() string {
+	if term := os.Getenv("TERMINAL"); term != "" {
+		return term + " -e"
+	}
+	return "xterm -e"
+}
+
+// function to check for a graphical session the terminal can open a window in
+func hasDisplay() bool {
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// function to run "launchpad edit", which edits the macro config of a launchpad in the terminal
+func runEdit(args []string) int {
+	flags := flag.NewFlagSet("edit", flag.ExitOnError)
+	device := flags.String("device", "", "id of the launchpad, needed when several have been used")
+	page := flags.Int("page", 0, "macro page shown first")
+	row := flags.Int("row", 0, "grid row selected first")
+	col := flags.Int("col", 0, "grid column selected first")
+	color := flags.String("color", defaultColor.String(), "color of new macros")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: launchpad edit [flags]\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	e, err := newEditor(*device)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening macros: %v\n", err)
+		return 1
+	}
+	if *page < 0 || *page >= macroPages || *row < 0 || *row > 7 || *col < 0 || *col > 7 {
+		fmt.Fprintf(os.Stderr, "Error: page must be 0-%d, row and col 0-7\n", macroPages-1)
+		return 2
+	}
+	e.page, e.row, e.col = *page, *row, *col
+	if e.color, err = parseColor(*color); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if err := e.run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// function to load the macro config of a device for editing
+func newEditor(device string) (*editor, error) {
+	if err := setConfig(); err != nil {
+		return nil, err
+	}
+	path, err := editPath(device)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &editor{path: path, cfg: cfg, saved: data, comments: hasComments(string(data)), in: bufio.NewReader(os.Stdin), out: bufio.NewWriter(os.Stdout)}, nil
+}
+
+// function to pick the macro file to edit, the shared file is used until a launchpad has been connected
+func editPath(device string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(macroDir, "devices"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+
+	// only open launchpads that have been connected, a mistyped -device would create a new config
+	if device != "" {
+		if !slices.Contains(ids, device) {
+			if len(ids) == 0 {
+				return "", fmt.Errorf("Launchpad %q has no macros, no launchpad has been connected yet", device)
+			}
+			return "", fmt.Errorf("Launchpad %q has no macros, pick one of: %s", device, strings.Join(ids, ", "))
+		}
+		return deviceMacroFile(device)
+	}
+	switch len(ids) {
+	case 0:
+		return macroFile, nil
+	case 1:
+		return deviceMacroFile(ids[0])
+	}
+	return "", fmt.Errorf("Several launchpads have macros, pick one with -device: %s", strings.Join(ids, ", "))
+}
+
+// function to run the editor until the user quits
+func (e *editor) run() error {
+	restore, err := rawTerminal()
+	if err != nil {
+		return err
+	}
+	// alternate screen without a cursor
+	e.out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		e.out.WriteString("\x1b[?25h\x1b[?1049l")
+		e.out.Flush()
+		restore()
+	}()
+
+	for {
+		e.draw()
+		key, err := e.readKey()
+		if err != nil {
+			return err
+		}
+		if done, err := e.handleKey(key); done || err != nil {
+			return err
+		}
+	}
+}
+
+// function to handle a key press on the grid, reporting when the editor should close
+func (e *editor) handleKey(key string) (bool, error) {
+	quitting := e.quitting
+	e.quitting = false
+	e.status = ""
+
+	switch key {
+	case keyUp, "k":
+		e.row = (e.row + 7) % 8
+	case keyDown, "j":
+		e.row = (e.row + 1) % 8
+	case keyLeft, "h":
+		e.col = (e.col + 7) % 8
+	case keyRight, "l":
+		e.col = (e.col + 1) % 8
+	case "[":
+		e.page = (e.page + macroPages - 1) % macroPages
+	case "]":
+		e.page = (e.page + 1) % macroPages
+	case "0", "1", "2", "3", "4", "5", "6", "7":
+		e.page = int(key[0] - '0')
+
+	case keyEnter, "e":
+		pad := e.pad()
+		if pad != nil && pad.toggle.any() {
+			e.status = "Toggle pads are edited in the config file"
+			break
+		}
+		value := ""
+		if pad != nil {
+			value = pad.cmd
+		}
+		cmd, ok, err := e.prompt("command: ", value)
+		if err != nil || !ok {
+			return false, err
+		}
+		// an empty command clears the pad like the record layer, gesture commands are kept
+		if strings.TrimSpace(cmd) == "" {
+			if pad != nil && pad.gestures.any() {
+				pad.cmd = ""
+				e.dirty = true
+			} else {
+				e.remove()
+			}
+			break
+		}
+		pad = e.bind()
+		pad.cmd, pad.action = cmd, ""
+
+	case "a":
+		pad := e.pad()
+		if pad != nil && pad.toggle.any() {
+			e.status = "Toggle pads are edited in the config file"
+			break
+		}
+		value := ""
+		if pad != nil {
+			value = pad.action
+		}
+		action, ok, err := e.prompt("action: ", value)
+		if err != nil || !ok {
+			return false, err
+		}
+		action = strings.TrimSpace(action)
+		if !validAction(action) {
+			e.status = fmt.Sprintf("Unknown action %q", action)
+			break
+		}
+		pad = e.bind()
+		pad.cmd, pad.action = "", action
+
+	case "c":
+		pad := e.pad()
+		if pad == nil {
+			e.status = "Bind a command first"
+			break
+		}
+		if pad.toggle.any() {
+			e.status = "Toggle pads are edited in the config file"
+			break
+		}
+		value, ok, err := e.prompt("color: ", pad.color.String())
+		if err != nil || !ok {
+			return false, err
+		}
+		color, err := parseColor(value)
+		if err != nil {
+			e.status = err.Error()
+			break
+		}
+		pad.color = color
+		e.dirty = true
+
+	case "L":
+		pad := e.pad()
+		if pad == nil {
+			e.status = "Bind a command first"
+			break
+		}
+		label, ok, err := e.prompt("label: ", pad.label)
+		if err != nil || !ok {
+			return false, err
+		}
+		pad.label = strings.TrimSpace(label)
+		e.dirty = true
+
+	case "d", keyDelete:
+		e.remove()
+
+	case "s":
+		return false, e.save()
+
+	case "q", keyCtrlC:
+		if e.dirty && !quitting {
+			e.quitting = true
+			e.status = "Unsaved changes, press s to save or q again to discard them"
+			break
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// function to get the selected pad, nil when it has no macro. Chords and shifted
+// pads are only edited in the config file, the editor leaves them as they are.
+func (e *editor) pad() *padConfig {
+	for i, pad := range e.cfg.pads {
+		if pad.single() && pad.page == e.page && pad.row == e.row && pad.col == e.col {
+			return &e.cfg.pads[i]
+		}
+	}
+	return nil
+}
+
+// function to get the selected pad, adding it to the config when it has no macro
+func (e *editor) bind() *padConfig {
+	e.dirty = true
+	if pad := e.pad(); pad != nil {
+		return pad
+	}
+	e.cfg.pads = append(e.cfg.pads, padConfig{page: e.page, row: e.row, col: e.col, color: e.color})
+	return &e.cfg.pads[len(e.cfg.pads)-1]
+}
+
+// function to remove the macro of the selected pad
+func (e *editor) remove() {
+	n := len(e.cfg.pads)
+	e.cfg.pads = slices.DeleteFunc(e.cfg.pads, func(pad padConfig) bool {
+		return pad.single() && pad.page == e.page && pad.row == e.row && pad.col == e.col
+	})
+	if len(e.cfg.pads) != n {
+		e.dirty = true
+	}
+}
+
+// function to save the changes, refusing once when the file was changed by someone else
+func (e *editor) save() error {
+	current, err := os.ReadFile(e.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if !bytes.Equal(current, e.saved) {
+		e.saved = current
+		e.comments = hasComments(string(current))
+		e.status = "Changed on disk since it was opened, press s again to overwrite"
+		return nil
+	}
+	// the file is written again from the config, so comments don't survive
+	if e.comments {
+		e.comments = false
+		e.status = "Saving drops the comments in the file, press s again to save, a backup is kept"
+		return nil
+	}
+
+	// pads are written in grid order, like the record layer saves them
+	slices.SortStableFunc(e.cfg.pads, func(a, b padConfig) int {
+		return (a.page*64 + a.row*8 + a.col) - (b.page*64 + b.row*8 + b.col)
+	})
+	if err := saveConfig(e.path, e.cfg); err != nil {
+		e.status = err.Error()
+		return nil
+	}
+	e.saved = []byte(e.cfg.String())
+	e.dirty = false
+	e.status = "Saved"
+	return nil
+}
+
+// function to draw the grid and the selected pad
+func (e *editor) draw() {
+	w := e.out
+	w.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(w, " launchpad edit - %s\r\n", e.path)
+	modified := ""
+	if e.dirty {
+		modified = "  (modified)"
+	}
+	fmt.Fprintf(w, " page %d (0-%d)%s\r\n\r\n", e.page, macroPages-1, modified)
+
+	// grid of 2 character swatches, the selected one in brackets
+	w.WriteString("     ")
+	for col := range 8 {
+		fmt.Fprintf(w, "  %d ", col)
+	}
+	w.WriteString("\r\n")
+	bound := map[[2]int]padConfig{}
+	for _, pad := range e.cfg.pads {
+		if pad.single() && pad.page == e.page {
+			bound[[2]int{pad.row, pad.col}] = pad
+		}
+	}
+	for row := range 8 {
+		fmt.Fprintf(w, "  %d  ", row)
+		for col := range 8 {
+			left, right := " ", " "
+			if row == e.row && col == e.col {
+				left, right = "[", "]"
+			}
+			w.WriteString(left)
+			if pad, ok := bound[[2]int{row, col}]; ok {
+				color := pad.color
+				if pad.toggle.any() {
+					color = pad.toggle.onColor
+				}
+				w.WriteString(swatch(color))
+			} else {
+				w.WriteString("\x1b[2m··\x1b[0m")
+			}
+			w.WriteString(right)
+		}
+		w.WriteString("\r\n")
+	}
+
+	// selected pad
+	fmt.Fprintf(w, "\r\n row %d, col %d\r\n", e.row, e.col)
+	if pad := e.pad(); pad != nil {
+		switch {
+		case pad.toggle.any():
+			fmt.Fprintf(w, "   toggle:  on: %s, off: %s\r\n", pad.toggle.on, pad.toggle.off)
+			fmt.Fprintf(w, "   colors:  on %s, off %s\r\n", pad.toggle.onColor, pad.toggle.offColor)
+		case pad.action != "":
+			fmt.Fprintf(w, "   action:  %s\r\n", pad.action)
+			fmt.Fprintf(w, "   color:   %s\r\n", pad.color)
+		default:
+			fmt.Fprintf(w, "   command: %s\r\n", pad.cmd)
+			fmt.Fprintf(w, "   color:   %s\r\n", pad.color)
+		}
+		fmt.Fprintf(w, "   label:   %s\r\n", pad.label)
+	} else {
+		w.WriteString("   no macro\r\n\r\n\r\n")
+	}
+
+	fmt.Fprintf(w, "\r\n %s\r\n\r\n", e.status)
+	w.WriteString(" arrows/hjkl move   [ ] or 0-7 page   enter/e command   a action\r\n")
+	w.WriteString(" c color   L label   d delete   s save   q quit\r\n")
+	w.Flush()
+}
+
+// function to show a launchpad color in the terminal
+func swatch(c Color) string {
+	if c.isOff() {
+		return "--"
+	}
+	levels := [4]int{0, 110, 180, 255}
+	return fmt.Sprintf("\x1b[48;2;%d;%d;0m  \x1b[0m", levels[c.Red], levels[c.Green])
+}
+
+// function to edit a line of text under the grid, reporting false when cancelled
+func (e *editor) prompt(label, value string) (string, bool, error) {
+	line := []rune(value)
+	cursor := len(line)
+	w := e.out
+	w.WriteString("\x1b[?25h")
+	defer w.WriteString("\x1b[?25l")
+
+	for {
+		// redraw the line on the status row
+		fmt.Fprintf(w, "\x1b[%d;1H\x1b[2K %s%s\x1b[%d;%dH", statusRow, label, string(line), statusRow, 2+utf8.RuneCountInString(label)+cursor)
+		w.Flush()
+
+		key, err := e.readKey()
+		if err != nil {
+			return "", false, err
+		}
+		switch key {
+		case keyEscape:
+			return "", false, nil
+		case keyLeft:
+			cursor = max(cursor-1, 0)
+		case keyRight:
+			cursor = min(cursor+1, len(line))
+		case keyHome:
+			cursor = 0
+		case keyEnd:
+			cursor = len(line)
+		case keyDelete:
+			if cursor < len(line) {
+				line = slices.Delete(line, cursor, cursor+1)
+			}
+		}
+		if strings.HasPrefix(key, keyEscape) {
+			continue
+		}
+
+		// typed or pasted text
+		for _, r := range key {
+			switch {
+			case r == '\r' || r == '\n':
+				return string(line), true, nil
+			case r == 0x03:
+				// ctrl-c cancels
+				return "", false, nil
+			case r == 0x01:
+				// ctrl-a and ctrl-e jump to the start and end
+				cursor = 0
+			case r == 0x05:
+				cursor = len(line)
+			case r == 0x15:
+				// ctrl-u clears up to the cursor
+				line = line[cursor:]
+				cursor = 0
+			case r == 0x7f || r == 0x08:
+				if cursor > 0 {
+					line = slices.Delete(line, cursor-1, cursor)
+					cursor--
+				}
+			case unicode.IsPrint(r):
+				line = slices.Insert(line, cursor, r)
+				cursor++
+			}
+		}
+	}
+}
+
+// function to read one key press, escape sequences are read as one key
+func (e *editor) readKey() (string, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	// the escape key on its own, a sequence arrives together with its escape
+	if r != 0x1b || e.in.Buffered() == 0 {
+		return string(r), nil
+	}
+	next, err := e.in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch next {
+	case 'O':
+		// some terminals send home and end as SS3 sequences
+		final, err := e.in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		return keyEscape + "[" + string(final), nil
+	case '[':
+		// CSI sequences end with a byte from @ to ~
+		seq := []byte(keyEscape + "[")
+		for {
+			c, err := e.in.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			seq = append(seq, c)
+			if c >= 0x40 && c <= 0x7e {
+				return string(seq), nil
+			}
+		}
+	}
+	// alt with a key
+	return keyEscape + string(next), nil
+}
+
+// function to switch the terminal to raw mode, returning a function restoring it
+func rawTerminal() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("launchpad edit needs a terminal: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() {
+		stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+// function to run stty on the terminal of stdin
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
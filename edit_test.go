@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEditPathDevice(t *testing.T) {
+	dir := t.TempDir()
+	oldDir, oldFile := macroDir, macroFile
+	macroDir, macroFile = dir+"/", filepath.Join(dir, "macros.toml")
+	t.Cleanup(func() {
+		macroDir, macroFile = oldDir, oldFile
+	})
+
+	// before any launchpad was connected the shared file is edited
+	if path, err := editPath(""); err != nil || path != macroFile {
+		t.Errorf("editPath(\"\") = %q, %v, want %q", path, err, macroFile)
+	}
+	if _, err := editPath("S"); err == nil {
+		t.Error("editPath found a launchpad that was never connected")
+	}
+
+	// a connected launchpad has its own file
+	path := filepath.Join(dir, "devices", "S", "macros.toml")
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("version = 1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, device := range []string{"", "S"} {
+		if got, err := editPath(device); err != nil || got != path {
+			t.Errorf("editPath(%q) = %q, %v, want %q", device, got, err, path)
+		}
+	}
+
+	// a mistyped device is an error and doesn't create a directory for it
+	_, err := editPath("s")
+	if err == nil || !strings.Contains(err.Error(), "pick one of: S") {
+		t.Errorf("editPath(\"s\") returned %v, want the known launchpads", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "devices", "s")); err == nil {
+		t.Error("editPath created a directory for a mistyped device")
+	}
+}
+
+func TestEditorSaveWithComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "macros.toml")
+	data := []byte("# my macros\nversion = 1\n")
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfig(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &editor{path: path, cfg: cfg, saved: data, comments: hasComments(string(data))}
+	e.bind().cmd = "true"
+
+	// the first save only warns that the comments would be lost
+	if err := e.save(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != string(data) || !strings.Contains(e.status, "drops the comments") {
+		t.Errorf("first save wrote %q, status %q", got, e.status)
+	}
+
+	// the second one saves
+	if err := e.save(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); !strings.Contains(string(got), `cmd = "true"`) || e.status != "Saved" {
+		t.Errorf("second save wrote %q, status %q", got, e.status)
+	}
+}
+
+// function to create an editor of an empty config reading key presses from a string
+func keyEditor(t *testing.T, keys string) *editor {
+	t.Helper()
+	cfg, err := parseConfig("version = 1\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &editor{
+		path:  filepath.Join(t.TempDir(), "macros.toml"),
+		cfg:   cfg,
+		color: defaultColor,
+		in:    bufio.NewReader(strings.NewReader(keys)),
+		out:   bufio.NewWriter(io.Discard),
+	}
+}
+
+// function to handle key presses until the input ends, reporting if the editor closed
+func typeKeys(t *testing.T, e *editor, keys string) bool {
+	t.Helper()
+	e.in = bufio.NewReader(strings.NewReader(keys))
+	for {
+		key, err := e.readKey()
+		if errors.Is(err, io.EOF) {
+			return false
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		done, err := e.handleKey(key)
+		if err != nil {
+			t.Fatalf("Error handling %q: %v", key, err)
+		}
+		if done {
+			return true
+		}
+	}
+}
+
+func TestEditorReadKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"jj", []string{"j", "j"}},
+		{keyUp + keyUp + keyRight, []string{keyUp, keyUp, keyRight}},
+		{keyDelete + "x", []string{keyDelete, "x"}},
+		{"\x1b[1;5C", []string{"\x1b[1;5C"}},
+		{"\x1bOH\x1bOF", []string{keyHome, keyEnd}},
+		{keyEscape, []string{keyEscape}},
+		{"\x1bj", []string{"\x1bj"}},
+		{"é♫\r", []string{"é", "♫", keyEnter}},
+		{keyCtrlC, []string{keyCtrlC}},
+	}
+	for _, test := range tests {
+		e := keyEditor(t, test.in)
+		var got []string
+		for {
+			key, err := e.readKey()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, key)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("readKey of %q = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestEditorHandleKey(t *testing.T) {
+	e := keyEditor(t, "")
+
+	// keys arriving together are each handled
+	typeKeys(t, e, "jj"+keyRight+keyRight+"l")
+	if e.row != 2 || e.col != 3 {
+		t.Errorf("selected %d,%d, want 2,3", e.row, e.col)
+	}
+	typeKeys(t, e, "kkk"+keyLeft+"]]7[")
+	if e.row != 7 || e.col != 2 || e.page != 6 {
+		t.Errorf("selected %d,%d on page %d, want 7,2 on page 6", e.row, e.col, e.page)
+	}
+
+	// a command binds the pad in the color of new pads
+	typeKeys(t, e, "eecho hi"+keyEnter)
+	pad := e.pad()
+	if pad == nil || pad.cmd != "echo hi" || pad.color != defaultColor || !e.dirty {
+		t.Fatalf("pad after entering a command: %+v", pad)
+	}
+	typeKeys(t, e, "c\x15red"+keyEnter+"Lhello"+keyEnter)
+	if pad.color != red || pad.label != "hello" {
+		t.Errorf("pad color %v and label %q, want red and hello", pad.color, pad.label)
+	}
+
+	// invalid input leaves the pad and shows why
+	typeKeys(t, e, "c\x15purple"+keyEnter)
+	if pad.color != red || e.status != "Unknown color: purple" {
+		t.Errorf("pad color %v, status %q", pad.color, e.status)
+	}
+	typeKeys(t, e, "anope"+keyEnter)
+	if pad.cmd != "echo hi" || !strings.HasPrefix(e.status, "Unknown action") {
+		t.Errorf("pad command %q, status %q", pad.cmd, e.status)
+	}
+
+	// a cancelled prompt changes nothing, an empty command clears the pad
+	typeKeys(t, e, "e\x15"+keyEscape)
+	if e.pad() == nil {
+		t.Error("cancelled prompt cleared the pad")
+	}
+	typeKeys(t, e, "e\x15"+keyEnter)
+	if e.pad() != nil {
+		t.Error("empty command kept the pad")
+	}
+
+	// quitting with unsaved changes asks first
+	if typeKeys(t, e, "q") || !e.quitting {
+		t.Errorf("first quit closed the editor, status %q", e.status)
+	}
+	if !typeKeys(t, e, "q") {
+		t.Error("second quit kept the editor open")
+	}
+}
+
+func TestEditorPrompt(t *testing.T) {
+	tests := []struct {
+		keys string
+		want string
+		ok   bool
+	}{
+		{keys: keyEnter, want: "echo", ok: true},
+		{keys: " hi" + keyEnter, want: "echo hi", ok: true},
+		{keys: keyLeft + keyLeft + "X" + keyEnter, want: "ecXho", ok: true},
+		{keys: keyHome + "X" + keyEnd + "Y" + keyEnter, want: "XechoY", ok: true},
+		{keys: "\x1bOHX\x1bOFY" + keyEnter, want: "XechoY", ok: true},
+		{keys: "\x01X\x05Y" + keyEnter, want: "XechoY", ok: true},
+		{keys: "\x7f\x08" + keyEnter, want: "ec", ok: true},
+		{keys: keyLeft + keyLeft + "\x15" + keyEnter, want: "ho", ok: true},
+		{keys: keyHome + keyDelete + keyRight + keyRight + keyRight + keyRight + keyDelete + keyEnter, want: "cho", ok: true},
+		{keys: "\x1b[1;5D" + "ünï" + keyEnter, want: "echoünï", ok: true},
+		{keys: " hi" + keyEscape, ok: false},
+		{keys: " hi" + keyCtrlC, ok: false},
+	}
+	for _, test := range tests {
+		e := keyEditor(t, test.keys)
+		got, ok, err := e.prompt("command: ", "echo")
+		if err != nil || got != test.want || ok != test.ok {
+			t.Errorf("prompt with %q = %q, %t, %v, want %q, %t", test.keys, got, ok, err, test.want, test.ok)
+		}
+	}
+
+	// the end of input is an error
+	if _, _, err := keyEditor(t, "abc").prompt("command: ", ""); !errors.Is(err, io.EOF) {
+		t.Errorf("prompt at the end of input returned %v, want EOF", err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+// number of LEDs in a frame: 64 grid, 8 right column and 8 top row
+const frameSize = 80
+
+// full set of LED colors in rapid update order
+type frame [frameSize]Color
+
+// function to get a buttons index in a frame
+func (b *button) frameIndex() int {
+	switch b.bType {
+	case GRID:
+		return b.y*8 + b.x
+	case RIGHT:
+		return 64 + b.y
+	}
+	return 72 + b.x
+}
+
+// function to get the button at a frame index
+func (lp *launchpad) frameButton(i int) *button {
+	switch {
+	case i < 64:
+		return lp.gridButtons[i/8][i%8]
+	case i < 72:
+		return lp.rightButtons[i-64]
+	}
+	return lp.topButtons[i-72]
+}
+
+// function to get all buttons in frame order
+func (lp *launchpad) frameButtons() []*button {
+	buttons := make([]*button, 0, frameSize)
+	for _, row := range lp.gridButtons {
+		buttons = append(buttons, row...)
+	}
+	buttons = append(buttons, lp.rightButtons...)
+	return append(buttons, lp.topButtons...)
+}
+
+// function to create a frame holding the current persistent LED colors
+func (lp *launchpad) newFrame() *frame {
+	return lp.leds.frame()
+}
+
+// function to set the color of a button in the frame
+func (f *frame) set(b *button, color Color) {
+	f[b.frameIndex()] = color
+}
+
+// function to save a frame as the persistent LED colors and draw it in one step
+func (lp *launchpad) flush(f *frame) error {
+	return lp.leds.setFrame(f)
+}
+
+// function to get the grid buttons in a square ring around the center, 0 is the innermost ring
+func (lp *launchpad) gridRing(ring int) []*button {
+	var buttons []*button
+	for _, row := range lp.gridButtons {
+		for _, b := range row {
+			if max(ringDistance(b.x), ringDistance(b.y)) == ring {
+				buttons = append(buttons, b)
+			}
+		}
+	}
+	return buttons
+}
+
+// function to get the distance of a grid coordinate from the center pair of rows or columns
+func ringDistance(i int) int {
+	if i < 4 {
+		return 3 - i
+	}
+	return i - 4
+}
+
+// function to set every LED of a grid ring to one color
+func (lp *launchpad) drawRing(ring int, color Color) error {
+	f := lp.newFrame()
+	for _, b := range lp.gridRing(ring) {
+		f.set(b, color)
+	}
+	return lp.flush(f)
+}
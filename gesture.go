@@ -0,0 +1,174 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// kinds of gestures made with a grid pad
+type gestureKind int
+
+const (
+	gestureTap       gestureKind = iota // pressed and released, and no second tap followed
+	gestureDoubleTap                    // pressed again soon after a tap
+	gestureLongPress                    // held down past the long press time, fires while still held
+	gestureRelease                      // released, after any other gesture
+)
+
+// default time a pad is held for a long press
+const defaultLongPress = 500 * time.Millisecond
+
+// default time between the taps of a double tap
+const defaultDoubleTap = 250 * time.Millisecond
+
+// gesture recognized on a pad
+type gesture struct {
+	kind   gestureKind
+	button *button
+}
+
+// commands run by the gestures of a pad, besides cmd which runs on a tap
+type gestureCommands struct {
+	doubleTap string // run on a double tap
+	longPress string // run when held past the long press time
+	release   string // run on every release
+}
+
+// function to get the command of a gesture, empty when it has none
+func (g gestureCommands) command(kind gestureKind) string {
+	switch kind {
+	case gestureDoubleTap:
+		return g.doubleTap
+	case gestureLongPress:
+		return g.longPress
+	case gestureRelease:
+		return g.release
+	}
+	return ""
+}
+
+// function to check if any gesture has a command
+func (g gestureCommands) any() bool {
+	return g.doubleTap != "" || g.longPress != "" || g.release != ""
+}
+
+// function to check if taps must wait to tell them apart from other gestures
+func (g gestureCommands) delaysTap() bool {
+	return g.doubleTap != "" || g.longPress != ""
+}
+
+// gesture state of one pad
+type padGesture struct {
+	held   bool      // currently held down
+	down   time.Time // when it was last pressed
+	done   bool      // the current press already fired a long press or double tap
+	tapped bool      // a tap is waiting to see if a second one follows
+	tapAt  time.Time // when the waiting tap was released
+}
+
+// recognizer turning presses and releases into gestures, time is passed in so
+// the outcome only depends on the timestamps it is given
+type gestureRecognizer struct {
+	longPress time.Duration                          // hold time of a long press
+	doubleTap time.Duration                          // longest time between the taps of a double tap
+	wants     func(b *button, kind gestureKind) bool // whether a pad uses a gesture, nil for every gesture
+	pads      map[*button]*padGesture
+}
+
+// function to create a recognizer with the default times
+func newGestureRecognizer(wants func(b *button, kind gestureKind) bool) *gestureRecognizer {
+	return &gestureRecognizer{longPress: defaultLongPress, doubleTap: defaultDoubleTap, wants: wants, pads: map[*button]*padGesture{}}
+}
+
+// function to check if a pad uses a gesture
+func (r *gestureRecognizer) uses(b *button, kind gestureKind) bool {
+	return r.wants == nil || r.wants(b, kind)
+}
+
+// function to get the state of a pad
+func (r *gestureRecognizer) pad(b *button) *padGesture {
+	p, ok := r.pads[b]
+	if !ok {
+		p = &padGesture{}
+		r.pads[b] = p
+	}
+	return p
+}
+
+// function to handle a pad being pressed at a time
+func (r *gestureRecognizer) press(b *button, now time.Time) []gesture {
+	p := r.pad(b)
+	var gestures []gesture
+	if p.tapped {
+		p.tapped = false
+		if now.Sub(p.tapAt) <= r.doubleTap {
+			// the second tap fires straight away, its release is only a release
+			p.held, p.down, p.done = true, now, true
+			return append(gestures, gesture{gestureDoubleTap, b})
+		}
+		// the waiting tap ran out before tick noticed
+		gestures = append(gestures, gesture{gestureTap, b})
+	}
+	p.held, p.down, p.done = true, now, false
+	return gestures
+}
+
+// function to handle a pad being released at a time
+func (r *gestureRecognizer) release(b *button, now time.Time) []gesture {
+	p := r.pad(b)
+	if !p.held {
+		return nil
+	}
+	gestures := r.tick(now)
+	p.held = false
+	if !p.done {
+		if r.uses(b, gestureDoubleTap) {
+			// wait to see if a second tap follows
+			p.tapped, p.tapAt = true, now
+		} else {
+			gestures = append(gestures, gesture{gestureTap, b})
+		}
+	}
+	return append(gestures, gesture{gestureRelease, b})
+}
+
+// function to fire the long presses and waiting taps that are due at a time
+func (r *gestureRecognizer) tick(now time.Time) []gesture {
+	var gestures []gesture
+	for b, p := range r.pads {
+		if p.held && !p.done && r.uses(b, gestureLongPress) && now.Sub(p.down) >= r.longPress {
+			p.done = true
+			gestures = append(gestures, gesture{gestureLongPress, b})
+		}
+		if p.tapped && now.Sub(p.tapAt) > r.doubleTap {
+			p.tapped = false
+			gestures = append(gestures, gesture{gestureTap, b})
+		}
+	}
+	// pads in grid order so the outcome doesn't depend on map order
+	slices.SortFunc(gestures, func(a, b gesture) int {
+		return cmp.Compare(a.button.frameIndex(), b.button.frameIndex())
+	})
+	return gestures
+}
+
+// function to get the next time tick has a gesture to fire, false when nothing is pending
+func (r *gestureRecognizer) deadline() (time.Time, bool) {
+	var next time.Time
+	pending := false
+	due := func(t time.Time) {
+		if !pending || t.Before(next) {
+			next, pending = t, true
+		}
+	}
+	for b, p := range r.pads {
+		if p.held && !p.done && r.uses(b, gestureLongPress) {
+			due(p.down.Add(r.longPress))
+		}
+		if p.tapped {
+			due(p.tapAt.Add(r.doubleTap + time.Nanosecond))
+		}
+	}
+	return next, pending
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// function to get a time some milliseconds after the start of a test
+func ms(n int) time.Time {
+	return time.Unix(0, 0).Add(time.Duration(n) * time.Millisecond)
+}
+
+// function to check the kinds of gestures recognized on a pad
+func checkGestures(t *testing.T, step string, got []gesture, b *button, want ...gestureKind) {
+	t.Helper()
+	var kinds []gestureKind
+	for _, g := range got {
+		if g.button != b {
+			t.Errorf("%s: gesture on row %d, col %d, want row %d, col %d", step, g.button.y, g.button.x, b.y, b.x)
+		}
+		kinds = append(kinds, g.kind)
+	}
+	if !slices.Equal(kinds, want) {
+		t.Errorf("%s: got gestures %v, want %v", step, kinds, want)
+	}
+}
+
+// function to create a recognizer where every pad uses double taps and long presses
+func testRecognizer() *gestureRecognizer {
+	r := newGestureRecognizer(nil)
+	r.longPress, r.doubleTap = 500*time.Millisecond, 250*time.Millisecond
+	return r
+}
+
+func TestTapWithoutDoubleTap(t *testing.T) {
+	// pads without a double tap command tap as soon as they are released
+	r := newGestureRecognizer(func(b *button, kind gestureKind) bool { return false })
+	b := &button{x: 1, y: 2, bType: GRID}
+	checkGestures(t, "press", r.press(b, ms(0)), b)
+	checkGestures(t, "release", r.release(b, ms(50)), b, gestureTap, gestureRelease)
+	if _, ok := r.deadline(); ok {
+		t.Error("deadline pending after a tap")
+	}
+}
+
+func TestTapWaitsForDoubleTap(t *testing.T) {
+	r := testRecognizer()
+	b := &button{x: 0, y: 0, bType: GRID}
+	checkGestures(t, "press", r.press(b, ms(0)), b)
+	checkGestures(t, "release", r.release(b, ms(50)), b, gestureRelease)
+
+	// the tap fires once the double tap time has passed
+	next, ok := r.deadline()
+	if !ok || !next.After(ms(300)) || next.After(ms(301)) {
+		t.Errorf("deadline = %v, %t, want just after %v", next, ok, ms(300))
+	}
+	checkGestures(t, "tick inside the window", r.tick(ms(300)), b)
+	checkGestures(t, "tick after the window", r.tick(ms(301)), b, gestureTap)
+	checkGestures(t, "tick again", r.tick(ms(400)), b)
+}
+
+func TestTapFlushedByLaterPress(t *testing.T) {
+	r := testRecognizer()
+	b := &button{x: 3, y: 4, bType: GRID}
+	r.press(b, ms(0))
+	r.release(b, ms(50))
+
+	// no tick came, the next press outside the window fires the waiting tap and starts over
+	checkGestures(t, "late press", r.press(b, ms(400)), b, gestureTap)
+	checkGestures(t, "release", r.release(b, ms(450)), b, gestureRelease)
+	checkGestures(t, "tick", r.tick(ms(701)), b, gestureTap)
+}
+
+func TestDoubleTap(t *testing.T) {
+	r := testRecognizer()
+	b := &button{x: 7, y: 7, bType: GRID}
+	r.press(b, ms(0))
+	r.release(b, ms(50))
+
+	// the second press inside the window fires straight away
+	checkGestures(t, "second press", r.press(b, ms(300)), b, gestureDoubleTap)
+	// its release is only a release, without another tap waiting
+	checkGestures(t, "second release", r.release(b, ms(350)), b, gestureRelease)
+	checkGestures(t, "tick", r.tick(ms(1000)), b)
+	if _, ok := r.deadline(); ok {
+		t.Error("deadline pending after a double tap")
+	}
+}
+
+func TestDoubleTapOutsideWindow(t *testing.T) {
+	r := testRecognizer()
+	b := &button{x: 2, y: 1, bType: GRID}
+	r.press(b, ms(0))
+	r.release(b, ms(50))
+	checkGestures(t, "tick", r.tick(ms(301)), b, gestureTap)
+
+	// a second press after the tap fired is a new press
+	checkGestures(t, "second press", r.press(b, ms(320)), b)
+	checkGestures(t, "second release", r.release(b, ms(360)), b, gestureRelease)
+	checkGestures(t, "tick", r.tick(ms(611)), b, gestureTap)
+}
+
+func TestLongPressFromTick(t *testing.T) {
+	r := testRecognizer()
+	b := &button{x: 5, y: 0, bType: GRID}
+	r.press(b, ms(0))
+	if next, ok := r.deadline(); !ok || !next.Equal(ms(500)) {
+		t.Errorf("deadline = %v, %t, want %v", next, ok, ms(500))
+	}
+	checkGestures(t, "tick before the hold time", r.tick(ms(499)), b)
+	checkGestures(t, "tick at the hold time", r.tick(ms(500)), b, gestureLongPress)
+	checkGestures(t, "tick while still held", r.tick(ms(900)), b)
+
+	// the release after a long press doesn't tap
+	checkGestures(t, "release", r.release(b, ms(1000)), b, gestureRelease)
+	checkGestures(t, "tick", r.tick(ms(2000)), b)
+}
+
+func TestLongPressInRelease(t *testing.T) {
+	r := testRecognizer()
+	b := &button{x: 6, y: 3, bType: GRID}
+	r.press(b, ms(0))
+
+	// no tick came before the release, the long press still fires first
+	checkGestures(t, "release", r.release(b, ms(700)), b, gestureLongPress, gestureRelease)
+	if _, ok := r.deadline(); ok {
+		t.Error("deadline pending after a long press")
+	}
+}
+
+func TestGesturesInGridOrder(t *testing.T) {
+	r := testRecognizer()
+	a := &button{x: 1, y: 5, bType: GRID}
+	b := &button{x: 4, y: 2, bType: GRID}
+	r.press(a, ms(0))
+	r.press(b, ms(10))
+
+	// both long presses are due, they come out in grid order whatever the map order
+	got := r.tick(ms(600))
+	if len(got) != 2 || got[0].button != b || got[1].button != a {
+		t.Errorf("got %d gestures, want the long press of row 2 then row 5", len(got))
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// file listing the sound cards known to ALSA
+const asoundCards = "/proc/asound/cards"
+
+// how often the device is checked for being unplugged or plugged back in
+const hotplugInterval = time.Second
+
+// function to keep listening to the launchpad, reopening it after it is unplugged
+func (lp *launchpad) stayConnected() {
+	dev, midi := lp.device, lp.midi
+	for {
+		// watch for the launchpad being unplugged while listening
+		done := make(chan struct{})
+		go lp.watchDevice(done, midi, dev.port)
+
+		// listen until the connection is lost
+		err := lp.listen(midi)
+		close(done)
+		slog.Warn("Lost connection to launchpad", "device", dev.id, "err", err)
+
+		// stop when shutting down
+		if lp.ctx.Err() != nil {
+			return
+		}
+
+		// keep LED changes in memory until the launchpad is back
+		lp.leds.setMidi(nil)
+		midi.close()
+
+		// wait for the launchpad to come back
+		var ok bool
+		if dev, midi, ok = lp.reconnect(); !ok {
+			return
+		}
+	}
+}
+
+// function to close the connection once the launchpad's sound card disappears,
+// which stops a listen blocked on the dead device
+func (lp *launchpad) watchDevice(done chan struct{}, midi transport, port string) {
+	card, err := cardPath(port)
+	if err != nil {
+		slog.Error("Error watching launchpad", "err", err)
+		return
+	}
+	ticker := time.NewTicker(hotplugInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if _, err := os.Stat(card); err != nil {
+				midi.close()
+				return
+			}
+		}
+	}
+}
+
+// function to wait for a launchpad to be plugged in and reopen it with the current LED state,
+// ok is false when the launchpad shuts down first
+func (lp *launchpad) reconnect() (midiDevice, transport, bool) {
+	slog.Info("Waiting for launchpad to be plugged back in", "device", lp.device.id)
+	for {
+		select {
+		case <-lp.ctx.Done():
+			return midiDevice{}, nil, false
+		case <-time.After(hotplugInterval):
+		}
+		if !launchpadPresent() {
+			continue
+		}
+		// the same device may come back on a different port
+		dev, err := findDevice(lp.device.id)
+		if err != nil {
+			continue
+		}
+		midi, err := openTransport(dev.port)
+		if err != nil {
+			slog.Error("Error reopening launchpad", "device", dev.id, "err", err)
+			continue
+		}
+		if lp.ctx.Err() != nil {
+			midi.close()
+			return midiDevice{}, nil, false
+		}
+
+		// send the current layer's LEDs to the new connection
+		if err := lp.leds.setMidi(midi); err != nil {
+			slog.Error("Error redrawing launchpad", "device", dev.id, "err", err)
+		}
+		slog.Info("Reconnected to launchpad", "device", dev.id, "port", dev.port)
+		return dev, midi, true
+	}
+}
+
+// function to check if ALSA lists a launchpad sound card
+func launchpadPresent() bool {
+	cards, err := os.ReadFile(asoundCards)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(cards), "Launchpad")
+}
+
+// function to get the /proc/asound directory of an amidi port in format "hw:x,x,x"
+func cardPath(port string) (string, error) {
+	fields := strings.Split(strings.TrimPrefix(port, "hw:"), ",")
+	if fields[0] == "" {
+		return "", fmt.Errorf("Invalid midi port: %s", port)
+	}
+	return "/proc/asound/card" + fields[0], nil
+}
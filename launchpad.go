@@ -1,9 +1,9 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"strconv"
@@ -11,76 +11,294 @@ import (
 	"time"
 )
 
+// time the startup splash is shown for
+var splashTime = time.Second
+
 // top row vs grid row codes
 const topRow = 0xB0
 const gridRow = 0x90
 
-// layer command enum
+// kinds of events handled by the main loop
 const (
-	FREEZE = iota
-	PAINT
-	BREATHE
-	ALL
-	MACRO
-	RECORD
+	buttonEvent  = iota // a grid or right column button was pressed or released
+	layerEvent          // a top row button was pressed
+	configEvent         // the macro config was changed
+	controlEvent        // a request arrived on the control socket
+	toggleEvent         // a toggle pad was switched on or off
 )
 
+// input for the main loop, which owns the layers, buttons and macro bindings
+type event struct {
+	kind    int          // buttonEvent, layerEvent, configEvent, controlEvent or toggleEvent
+	button  *button      // button of a buttonEvent
+	pressed bool         // whether the button of a buttonEvent is held down
+	at      time.Time    // when the button of a buttonEvent was pressed or released
+	layer   int          // top row button of a layerEvent
+	config  *macroConfig // new config of a configEvent
+	control *controlCall // request of a controlEvent
+	toggle  toggleState  // new state of a toggleEvent
+}
+
 // launchpad struct
 type launchpad struct {
-	topButtons   []*button      // array x index to topRow buttons
-	rightButtons []*button      // array y index of right collumn buttons
-	gridButtons  [][]*button    // 2D array of buttons - first index for row, second index for collumn
-	buttonChan   chan *button   // channel for current button
-	layerCMDs    []func() error // array of layer functions
-	layer        int            // current active 'layer' (0-7) tied to top row
-	userColor    int            // current color selected by user
+	topButtons   []*button                      // array x index to topRow buttons
+	rightButtons []*button                      // array y index of right collumn buttons
+	gridButtons  [][]*button                    // 2D array of buttons - first index for row, second index for collumn
+	events       chan event                     // button and layer events for the main loop
+	ctx          context.Context                // cancelled when the launchpad shuts down
+	cancel       context.CancelFunc             // cancels ctx
+	runs         *macroRuns                     // macro commands that haven't exited yet
+	onExit       string                         // what happens to running macros on shutdown
+	gestures     *gestureRecognizer             // taps, double taps, long presses and releases of the grid pads
+	pressed      pressedSet                     // buttons held down, whether or not layers were told yet
+	chordMatch   *chordMatcher                  // presses held back until it is known whether they make a chord
+	automata     map[string]automatonConfig     // settings of automaton layers by name, missing ones use the defaults
+	layers       []Layer                        // layer of each top row button, nil for unused buttons
+	layer        int                            // current active 'layer' (0-7) tied to top row
+	userColor    Color                          // current color selected by user
+	midi         transport                      // connection the launchpad was first opened with
+	device       midiDevice                     // port, name and id of the launchpad when it was first opened
+	macroFile    string                         // path of this launchpad's macro file
+	leds         *renderer                      // LED state drawn to the launchpad
+	profile      deviceProfile                  // addressing and colors of the launchpad model
+	pages        [macroPages][8][8]macroBinding // macro bindings of every page by row and collumn
+	chords       [macroPages][]chordBinding     // chords and shifted pads of every page
+	toggles      map[[3]int]bool                // toggle pads that are on by page, row and collumn
+	toggleFile   string                         // path of the saved toggle states
+	toggling     map[[3]int]bool                // toggle pads whose on or off command is still running
+	page         int                            // macro page shown by the grid buttons
 }
 
 // function to start the launchpad
 func (lp *launchpad) start() error {
 
-	fmt.Println("Started launchpad!")
+	slog.Info("Started launchpad", "device", lp.device.id)
 
 	// draw startup flower spash
 	lp.drawFlower()
-	time.Sleep(time.Second * 1)
+	time.Sleep(splashTime)
 
 	// clear LEDs and enable color selector pallette
 	lp.allOff()
 	lp.pallette()
 
-	// start listening for button events
-	go lp.listen()
-	prevLayer := 0
+	// start listening for button events, the simulator can't be replugged so it stops at the end of input
+	if transportName == simName {
+		go func() {
+			if err := lp.listen(lp.midi); err != nil {
+				slog.Info("Stopped listening to launchpad", "device", lp.device.id, "err", err)
+			}
+			lp.stop()
+		}()
+	} else {
+		go lp.stayConnected()
+	}
 	lp.topButtons[lp.layer].ledOn(lp.userColor)
+
+	// pick up hand edits of the macro config
+	go lp.watchConfig()
+
+	// toggle pads find out if they are really on
+	lp.queryToggles()
+
+	// show the first layer
+	current := lp.currentLayer()
+	if err := current.Enter(); err != nil {
+		slog.Error("Error entering layer", "device", lp.device.id, "layer", current.Name(), "err", err)
+	}
+	ticks := newLayerTicker(current)
+	pendingTimer := time.NewTimer(0)
+	pendingTimer.Stop()
 	for {
-		// run current layers command
-		if err := lp.layerCMDs[lp.layer](); err != nil {
-			return err
-		}
-		// layer has changed
-		if prevLayer != lp.layer {
-			fmt.Printf("Switching to layer: %d!\n", lp.layer)
-			// clear grid unless layer is freeze or paint
-			if lp.layer != FREEZE && lp.layer != PAINT {
-				lp.gridOff()
+		// wait for an event, a tick of the current layer or shutdown, errors such as a missing launchpad don't stop the program
+		var err error
+		select {
+		case <-lp.ctx.Done():
+			ticks.stop()
+			return lp.shutdown(current)
+
+		case ev := <-lp.events:
+			switch ev.kind {
+			case layerEvent:
+				// top buttons with an action run it instead of changing layer
+				if b := lp.topButtons[ev.layer]; b.action != "" {
+					go lp.runAction(b, b.action)
+					break
+				}
+				if lp.layers[ev.layer] == nil {
+					break
+				}
+				next := lp.layers[ev.layer]
+				if next == current {
+					// refresh grid when same layer pressed
+					lp.gridOff()
+					err = current.Enter()
+					break
+				}
+				// turn off led for old layer and switch
+				lp.topOff()
+				lp.layer = ev.layer
+				lp.chordMatch.reset()
+				lp.switchLayer(current, next)
+				current = next
+				ticks.stop()
+				ticks = newLayerTicker(current)
+
+			case buttonEvent:
+				lp.pressed.update(ev.button, ev.pressed, ev.at)
+				// layers with chords only get presses once they can't be part of a chord
+				events := []chordEvent{{button: ev.button, pressed: ev.pressed, at: ev.at}}
+				if _, ok := current.(chordLayer); ok {
+					if ev.pressed {
+						events = lp.chordMatch.press(ev.button, ev.at, lp.chords[lp.page], lp.pressed)
+					} else {
+						events = lp.chordMatch.release(ev.button, ev.at)
+					}
+				}
+				err = lp.handleButtons(current, events)
+
+			case configEvent:
+				lp.applyConfig(ev.config, current)
+
+			case controlEvent:
+				ev.control.reply <- lp.control(ev.control.req, current)
+
+			case toggleEvent:
+				lp.setToggle(ev.toggle, current)
 			}
-			if lp.layer == RECORD {
-				go lp.macroFlash()
+
+		case <-ticks.c:
+			err = current.Tick()
+
+		case now := <-pendingTimer.C:
+			err = lp.handleButtons(current, lp.chordMatch.tick(now))
+			if err == nil {
+				err = lp.handleGestures(current, lp.gestures.tick(now))
 			}
-			// update previous layer var
-			prevLayer = lp.layer
+		}
+		if err != nil {
+			slog.Error("Error running layer", "device", lp.device.id, "layer", current.Name(), "err", err)
+		}
+		// wake up for the next held back press, long press or tap that has waited long enough
+		next, ok := lp.gestures.deadline()
+		if chordNext, chordOk := lp.chordMatch.deadline(); chordOk && (!ok || chordNext.Before(next)) {
+			next, ok = chordNext, true
+		}
+		if ok {
+			pendingTimer.Reset(time.Until(next))
+		} else {
+			pendingTimer.Stop()
+		}
+		// layers such as life change their speed or pause
+		if current.TickInterval() != ticks.interval {
+			ticks.stop()
+			ticks = newLayerTicker(current)
 		}
 		// enable led of current layer
 		lp.topButtons[lp.layer].ledOn(lp.userColor)
 	}
 }
 
+// function to queue an event for the main loop, dropped once the loop has stopped
+func (lp *launchpad) post(ev event) {
+	select {
+	case lp.events <- ev:
+	case <-lp.ctx.Done():
+	}
+}
+
+// function to pass presses, releases and chords let through by the chord matcher to the layer
+func (lp *launchpad) handleButtons(current Layer, events []chordEvent) error {
+	for _, ev := range events {
+		if ev.chord != nil {
+			if l, ok := current.(chordLayer); ok {
+				if err := l.HandleChord(ev.chord); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		b := ev.button
+		b.pressed = ev.pressed
+		// change color for right button, unless the layer uses them as its own controls
+		if b.bType == RIGHT && !usesRightColumn(current) {
+			lp.userColor = b.color()
+		}
+		if err := current.HandleEvent(b); err != nil {
+			return err
+		}
+
+		// grid pads also make gestures
+		if b.bType != GRID {
+			continue
+		}
+		var gestures []gesture
+		if ev.pressed {
+			gestures = lp.gestures.press(b, ev.at)
+		} else {
+			gestures = lp.gestures.release(b, ev.at)
+		}
+		if err := lp.handleGestures(current, gestures); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function to pass gestures to layers that use them
+func (lp *launchpad) handleGestures(current Layer, gestures []gesture) error {
+	l, ok := current.(gestureLayer)
+	if !ok {
+		return nil
+	}
+	for _, g := range gestures {
+		if err := l.HandleGesture(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function to stop the main loop
+func (lp *launchpad) stop() {
+	lp.cancel()
+}
+
+// function to leave the launchpad dark, deal with running macros and close the connection
+func (lp *launchpad) shutdown(current Layer) error {
+	slog.Info("Shutting down launchpad", "device", lp.device.id)
+	if err := current.Exit(); err != nil {
+		slog.Error("Error leaving layer", "device", lp.device.id, "layer", current.Name(), "err", err)
+	}
+
+	// macros flash their result, so they finish before the LEDs are reset
+	lp.runs.finish(lp.onExit)
+
+	// turn every LED off, then stop listening
+	err := lp.forceAllOff()
+	if err := lp.leds.close(); err != nil {
+		slog.Error("Error closing launchpad", "device", lp.device.id, "err", err)
+	}
+	return err
+}
+
+// function to run the action, toggle or command of a pad, actions run outside the main loop
+func (lp *launchpad) runMacro(b *button) error {
+	if b.action != "" {
+		go lp.runAction(b, b.action)
+		return nil
+	}
+	if b.toggle.any() {
+		return lp.toggle(b, lp.page)
+	}
+	return b.execute(lp.runs)
+}
+
 // function to turn on led of any buttons with a set command
 func (lp *launchpad) macroLights() error {
 	for _, row := range lp.gridButtons {
 		for _, b := range row {
-			if b.cmd != "" {
+			if b.bound() {
 				b.ledOn(b.macroColor)
 			}
 		}
@@ -89,32 +307,54 @@ func (lp *launchpad) macroLights() error {
 	return nil
 }
 
-// function to flash grid buttons with macro command
-func (lp *launchpad) macroFlash() {
-	for lp.layer == RECORD {
-		lp.gridOff()
-		time.Sleep(time.Millisecond * 500)
-		lp.macroLights()
-		time.Sleep(time.Millisecond * 500)
-	}
-}
-
-// function to return launchpad struct
-func getLaunchpad() (*launchpad, error) {
+// function to return launchpad struct for a device, it shuts down when ctx is cancelled
+func getLaunchpad(ctx context.Context, dev midiDevice) (*launchpad, error) {
 
 	// initialise launchpad
 	var lp launchpad
+	lp.device = dev
+	lp.ctx, lp.cancel = context.WithCancel(ctx)
+	lp.runs = newMacroRuns()
+	lp.pressed = pressedSet{}
+	lp.chordMatch = newChordMatcher()
+	// only gestures with a command are told apart, so other taps aren't delayed
+	lp.gestures = newGestureRecognizer(func(b *button, kind gestureKind) bool {
+		return b.gestures.command(kind) != ""
+	})
+
+	// get the device's own macro file
+	var err error
+	lp.macroFile, err = deviceMacroFile(dev.id)
+	if err != nil {
+		return nil, err
+	}
+
+	// toggle pads start in the state they were left in
+	lp.toggleFile = toggleFile(lp.macroFile)
+	lp.toggling = map[[3]int]bool{}
+	if lp.toggles, err = loadToggles(lp.toggleFile); err != nil {
+		slog.Error("Error loading toggle states, every toggle starts off", "device", dev.id, "err", err)
+	}
+
+	// pick the model's note layout and color model
+	lp.profile = profileFor(dev.name)
+	slog.Info("Using device profile", "device", dev.id, "profile", lp.profile.name(), "name", dev.name)
+	lp.leds = newRenderer(lp.profile)
 
-	// get path to midi device
-	if err := getMidi(); err != nil {
+	// open the midi connection once for every LED write
+	lp.midi, err = openTransport(dev.port)
+	if err != nil {
+		return nil, err
+	}
+	if err := lp.leds.setMidi(lp.midi); err != nil {
 		return nil, err
 	}
 
-	// initialise button channel
-	lp.buttonChan = make(chan *button, 160)
+	// initialise event channels
+	lp.events = make(chan event, 160)
 
 	// initialise button arrays
-	fmt.Println("Creating buttons...")
+	slog.Debug("Creating buttons", "device", dev.id)
 	lp.topButtons = make([]*button, 8)
 	lp.rightButtons = make([]*button, 8)
 	lp.gridButtons = make([][]*button, 8)
@@ -122,19 +362,15 @@ func getLaunchpad() (*launchpad, error) {
 	// populate button arrays with coords and default values
 	for i := range 8 {
 		lp.gridButtons[i] = make([]*button, 8)
-		lp.topButtons[i] = &button{row: topRow, x: i, y: 6, color: defaultColor, macroColor: defaultColor, pressed: false, bType: TOP}
-		lp.rightButtons[i] = &button{row: gridRow, x: 8, y: i, color: defaultColor, macroColor: defaultColor, pressed: false, bType: RIGHT}
+		lp.topButtons[i] = &button{row: topRow, x: i, y: 6, macroColor: defaultColor, pressed: false, bType: TOP, leds: lp.leds}
+		lp.rightButtons[i] = &button{row: gridRow, x: 8, y: i, macroColor: defaultColor, pressed: false, bType: RIGHT, leds: lp.leds}
 		for j := range 8 {
-			lp.gridButtons[i][j] = &button{row: gridRow, x: j, y: i, color: defaultColor, macroColor: defaultColor, pressed: false, bType: GRID}
+			lp.gridButtons[i][j] = &button{row: gridRow, x: j, y: i, macroColor: defaultColor, pressed: false, bType: GRID, leds: lp.leds}
 		}
 	}
 
-	// get layer functions
-	fmt.Println("Setting up layers...")
-	lp.setLayerCMDs()
-
-	// get macros
-	fmt.Println("Setting up macros...")
+	// get macros and layers
+	slog.Debug("Setting up macros and layers", "device", dev.id)
 	if err := lp.getMacros(); err != nil {
 		return nil, err
 	}
@@ -143,145 +379,115 @@ func getLaunchpad() (*launchpad, error) {
 	return &lp, nil
 }
 
-// function to load macros
+// function to load macros and the top row layers
 func (lp *launchpad) getMacros() error {
-	file, err := os.Open(macroFile)
+	cfg, err := loadConfig(lp.macroFile)
 	if err != nil {
-		return fmt.Errorf("Error opening macro file: %v", err)
+		return err
 	}
-	defer file.Close()
-
-	// create new scanner
-	scanner := bufio.NewScanner(file)
-
-	// header row
-	scanner.Scan()
-
-	// command rows
-	for scanner.Scan() {
-		// get row, column, and command string
-		info := strings.Split(scanner.Text(), ",")
-		if len(info) != 4 {
-			return fmt.Errorf("Error scanning commands file, invalid line: %v", info)
-		}
-		row, err := strconv.Atoi(info[0])
-		if err != nil {
-			return fmt.Errorf("Error converting %s to a row: %v", info[0], err)
-		}
-		col, err := strconv.Atoi(info[1])
-		if err != nil {
-			return fmt.Errorf("Error converting %s to a column: %v", info[0], err)
-		}
-		color, err := strconv.Atoi(info[2])
-		if err != nil {
-			return fmt.Errorf("Error converting %s to a color: %v", info[0], err)
-		}
-
-		cmd := info[3]
-
-		// set button command
-		lp.gridButtons[row][col].cmd = cmd
-		lp.gridButtons[row][col].macroColor = color
-		fmt.Printf("Set button at row: %d, col: %d to '%s'.\n", row, col, cmd)
+	lp.setLayers(cfg)
 
+	// set button commands
+	lp.setMacros(cfg)
+	for _, pad := range cfg.pads {
+		slog.Debug("Set button macro", "device", lp.device.id, "page", pad.page, "row", pad.row, "col", pad.col, "cmd", pad.cmd)
 	}
 
 	// exit without error
 	return nil
 }
 
-// function to save macros to a file
-func (lp *launchpad) saveMacros() error {
-	file, err := os.Create(macroFile)
-	if err != nil {
-		return fmt.Errorf("Error opening macro file: %v", err)
-	}
-	defer file.Close()
-	if _, err := fmt.Fprint(file, "row,column,color,cmd\n"); err != nil {
-		return fmt.Errorf("Error writing macro file header: %v", err)
-	}
+// function to replace the macro bindings of every grid button in one step
+func (lp *launchpad) setMacros(cfg *macroConfig) {
 
-	// iterate over all grid buttons
-	for i, row := range lp.gridButtons {
-		for j, b := range row {
-			if b.cmd != "" {
-				if _, err := fmt.Fprintf(file, "%d,%d,%d,%s\n", i, j, b.macroColor, b.cmd); err != nil {
-					return fmt.Errorf("Error writing to macro file: %v", err)
-				}
+	// pads missing from the config lose their macro
+	for page := range lp.pages {
+		for i := range lp.pages[page] {
+			for j := range lp.pages[page][i] {
+				lp.pages[page][i][j] = macroBinding{color: defaultColor}
 			}
 		}
 	}
+	for page := range lp.chords {
+		lp.chords[page] = nil
+	}
+	for _, pad := range cfg.pads {
+		m := macroBinding{
+			cmd:      pad.cmd,
+			action:   pad.action,
+			gestures: pad.gestures,
+			toggle:   pad.toggle,
+			color:    pad.color,
+			label:    pad.label,
+			options:  pad.options(),
+		}
+		if pad.single() {
+			lp.pages[pad.page][pad.row][pad.col] = m
+			continue
+		}
+		// chords and shifted pads run instead of the macros of their buttons
+		c := chordBinding{button: lp.gridButtons[pad.row][pad.col], macro: m}
+		for _, pos := range pad.with {
+			c.with = append(c.with, lp.buttonAt(pos))
+		}
+		if pad.shift != nil {
+			c.shift = lp.buttonAt(*pad.shift)
+		}
+		lp.chords[pad.page] = append(lp.chords[pad.page], c)
+	}
+	lp.loadPage(lp.page)
+	lp.onExit = cfg.onExit
+	lp.gestures.longPress, lp.gestures.doubleTap = defaultLongPress, defaultDoubleTap
+	if cfg.longPress != 0 {
+		lp.gestures.longPress = cfg.longPress
+	}
+	if cfg.doubleTap != 0 {
+		lp.gestures.doubleTap = cfg.doubleTap
+	}
+	lp.chordMatch.window = defaultChordTime
+	if cfg.chordTime != 0 {
+		lp.chordMatch.window = cfg.chordTime
+	}
+	lp.automata = cfg.automata
 
-	file.Close()
-	fmt.Printf("Saved macros to file: %s!\n", file.Name())
-	// exit without error
-	return nil
+	for _, b := range lp.topButtons {
+		b.action = ""
+	}
+	for _, top := range cfg.tops {
+		lp.topButtons[top.col].action = top.action
+	}
 }
 
-// function to set the midi path used by the launchpad
-func getMidi() error {
-	fmt.Println("Finding midi port for the launchpad.")
-
-	// list midi devices
-	cmd := exec.Command(lpCmd, "-l")
-	out, err := cmd.Output()
+// function to put the macro config from before the last save back in place
+func (lp *launchpad) undoSave() error {
+	data, err := restoreBackup(lp.macroFile)
 	if err != nil {
-		return fmt.Errorf("Error getting midi path to launchpad: %v", err)
+		return err
 	}
+	return lp.reloadMacros(data)
+}
 
-	// split output into seperate lines
-	lines := strings.Split(string(out), "\n")
-	if len(lines) < 2 {
-		// error if no devices foudn
-		return fmt.Errorf("Could not find launchpad in midi devices: %v", lines)
+// function to run a buttons built in action, flashing the button green or red with the result.
+// Actions run outside the main loop and change its state through events.
+func (lp *launchpad) runAction(b *button, action string) {
+	var err error
+	switch action {
+	case undoAction:
+		err = lp.undoSave()
+	default:
+		err = fmt.Errorf("Unknown action: %s", action)
 	}
-
-	// iterate through output
-	for _, line := range lines {
-		// iterate through line containing 'Launchpad'
-		if strings.Contains(line, "Launchpad") {
-			for s := range strings.SplitSeq(line, " ") {
-
-				// find path in format "hw:x,x,x"
-				if strings.Contains(s, "hw") {
-					// set global variables
-					path := s
-					getArgs = []string{"-p", path, "-d"}
-					pushArgs = []string{"-p", path, "-S"}
-					fmt.Println("Found path for launchpad as: ", path)
-
-					// exit without error
-					return nil
-				}
-			}
-		}
+	if err != nil {
+		slog.Error("Error running action", "device", lp.device.id, "action", action, "err", err)
+		b.flash(red, 3, 333/2)
+		return
 	}
-
-	// error if not found
-	return fmt.Errorf("Could not find midi path for launchpad")
-}
-
-// function to set top row layers
-func (lp *launchpad) setLayerCMDs() {
-	lp.layerCMDs = make([]func() error, 8)
-
-	lp.layerCMDs[FREEZE] = lp.freeze
-	lp.layerCMDs[PAINT] = lp.paint
-	lp.layerCMDs[BREATHE] = lp.breathe
-	lp.layerCMDs[ALL] = lp.gridOn
-	lp.layerCMDs[MACRO] = lp.macro
-	lp.layerCMDs[RECORD] = lp.recordMacro
-
-	// UNIMPLEMENTED
-	lp.layerCMDs[6] = lp.colorDebug
-	lp.layerCMDs[7] = lp.freeze
+	b.flash(green, 3, 333/2)
 }
 
 // function to freeze launchpad LEDs as they are
-func (lp *launchpad) freeze() error {
+func (lp *launchpad) freeze(b *button) error {
 
-	// get button
-	b := lp.getBtn()
 	// exit if not a grid button
 	if b.bType != GRID {
 		return nil
@@ -289,215 +495,94 @@ func (lp *launchpad) freeze() error {
 
 	// reset button when released
 	if !b.pressed {
-		return b.ledOn(b.color)
+		return b.overlayOff()
 
 	}
 
-	// change the LED to a different color. use negative value to not save color
-	if b.color != lp.userColor {
-		return b.ledOn(-lp.userColor) // enable LED to user color
+	// change the LED to a different color without saving it
+	if b.color() != lp.userColor {
+		return b.overlayOn(lp.userColor) // enable LED to user color
 	}
 
 	// always use different color than current
-	if b.color == lime {
-		return b.ledOn(-amber)
+	if b.color() == lime {
+		return b.overlayOn(amber)
 	}
-	return b.ledOn(-lime)
-
-}
-
-// function to flash all leds
-func (lp *launchpad) strobe() error {
-	time.Sleep(time.Millisecond * 100)
-	lp.gridOff()
-	time.Sleep(time.Millisecond * 100)
-	return lp.gridOn()
-
-}
+	return b.overlayOn(lime)
 
-// function to ex/implode all leds
-func (lp *launchpad) breathe() error {
-	lp.implodeOff()
-	time.Sleep(time.Millisecond * 500)
-	lp.explodeOn()
-	time.Sleep(time.Millisecond * 500)
-	return nil
 }
 
-// function to constantly monitor launchapd input
-func (lp *launchpad) listen() error {
-	// loop forever
-	// create midi command
-	cmd := exec.Command(lpCmd, getArgs...)
-	stdout, err := cmd.StdoutPipe()
+// function to constantly monitor launchapd input, passing button presses to the main loop
+func (lp *launchpad) listen(midi transport) error {
+	// start receiving midi messages, a failure is handled like a lost connection
+	stdout, err := midi.receive()
 	if err != nil {
-		log.Fatalf("Error creating stdout: %v", err)
+		return fmt.Errorf("Error receiving from launchpad: %v", err)
 	}
-	// start the midi command
-	cmd.Start()
-	defer cmd.Process.Kill()
-	for {
+	defer stdout.Close()
 
-		// create buffer for the output
-		var output = make([]byte, 9)
-		n := 0
-		for n < 9 {
-			n, _ = stdout.Read(output)
-		}
-
-		// break output into parts
-		parts := strings.Split(string(output), " ")
-
-		// create button struct from midi
-		var b *button
-		row := parts[0]
-		x, _ := strconv.Atoi(parts[1][0:1])
-		y, _ := strconv.ParseInt(parts[1][1:], 16, 64)
-		pressed := parts[2] != "00"
-
-		// change layer for top button
-		if strings.Contains(row, fmt.Sprintf("%X", topRow)) {
-			b = lp.topButtons[y-8]
-			if pressed && b.x < len(lp.layerCMDs) {
-				// refresh grid when same layer pressed
-				if b.x == lp.layer {
-					lp.gridOff()
-				}
-				// turn off led for old layer
-				lp.topOff()
-				// switch layer
-				lp.layer = b.x
-				// turn on led for new layer
-				lp.topButtons[lp.layer].ledOn(lp.userColor)
-			}
-			// change color for right button
-		} else if y == 8 {
-			b = lp.rightButtons[x]
-			lp.userColor = b.color
-			// fmt.Println("Switching color to", lp.userColor)
-
-		} else {
-			b = lp.gridButtons[x][y]
+	// decode the raw midi byte stream
+	decoder := newMidiDecoder(stdout)
+	// loop forever
+	for {
+		ev, err := decoder.next()
+		if err != nil {
+			return fmt.Errorf("Error reading from launchpad: %v", err)
 		}
-		b.pressed = pressed
-		lp.buttonChan <- b
-	}
-}
-
-// function to get one line of launchpad input
-func (lp *launchpad) getBtn() *button {
-	return <-lp.buttonChan
-}
 
-// turn off all grid buttons
-func (lp *launchpad) gridOff() error {
-	for _, row := range lp.gridButtons {
-		for _, btn := range row {
-			if err := btn.ledOff(); err != nil {
-				return err
-			}
+		// find the button the message belongs to
+		b := lp.eventButton(ev)
+		if b == nil {
+			continue
 		}
-	}
-	return nil
-}
-
-// function to turn off all grid LEDs outside in
-func (lp *launchpad) implodeOff() error {
-	for i := range len(lp.gridButtons) / 2 {
-		for j := range len(lp.gridButtons[i]) / 2 {
+		pressed := ev.pressed()
 
-			btn := lp.gridButtons[j][i]
-			if err := btn.ledOff(); err != nil {
-				return err
-			}
-			btn = lp.gridButtons[j][7-i]
-			if err := btn.ledOff(); err != nil {
-				return err
-			}
-			btn = lp.gridButtons[7-j][i]
-			if err := btn.ledOff(); err != nil {
-				return err
-			}
-			btn = lp.gridButtons[7-j][7-i]
-			if err := btn.ledOff(); err != nil {
-				return err
+		// top buttons switch layers or run actions when pressed
+		if b.bType == TOP {
+			if pressed {
+				lp.post(event{kind: layerEvent, layer: b.x})
 			}
+			continue
 		}
+		lp.post(event{kind: buttonEvent, button: b, pressed: pressed, at: time.Now()})
 	}
-
-	return nil
 }
 
-// function to turn off all grid LEDs outside in
-func (lp *launchpad) implodeOn() error {
-	for i := range len(lp.gridButtons) / 2 {
-		for j := range len(lp.gridButtons[i]) / 2 {
-
-			btn := lp.gridButtons[j][i]
-			if err := btn.ledOn(lp.userColor); err != nil {
-				return err
-			}
-			btn = lp.gridButtons[j][7-i]
-			if err := btn.ledOn(lp.userColor); err != nil {
-				return err
-			}
-			btn = lp.gridButtons[7-j][i]
-			if err := btn.ledOn(lp.userColor); err != nil {
-				return err
-			}
-			btn = lp.gridButtons[7-j][7-i]
-			if err := btn.ledOn(lp.userColor); err != nil {
-				return err
-			}
-		}
+// function to find the button a midi message refers to, nil for unknown messages
+func (lp *launchpad) eventButton(ev midiEvent) *button {
+	i := lp.profile.padIndex(ev)
+	if i < 0 {
+		return nil
 	}
-
-	return nil
+	return lp.frameButton(i)
 }
 
-// function to turn off all grid LEDs outside in
-func (lp *launchpad) explodeOn() error {
-	for i := range len(lp.gridButtons) / 2 {
-		for j := range len(lp.gridButtons[i]) / 2 {
-
-			btn := lp.gridButtons[3-j][3-i]
-			if err := btn.ledOn(lp.userColor); err != nil {
-				return err
-			}
-			btn = lp.gridButtons[3-j][4+i]
-			if err := btn.ledOn(lp.userColor); err != nil {
-				return err
-			}
-			btn = lp.gridButtons[4+j][3-i]
-			if err := btn.ledOn(lp.userColor); err != nil {
-				return err
-			}
-			btn = lp.gridButtons[4+j][4+i]
-			if err := btn.ledOn(lp.userColor); err != nil {
-				return err
-			}
+// turn off all grid buttons
+func (lp *launchpad) gridOff() error {
+	f := lp.newFrame()
+	for _, row := range lp.gridButtons {
+		for _, btn := range row {
+			f.set(btn, off)
 		}
 	}
-
-	return nil
+	return lp.flush(f)
 }
 
 // turn on all grid buttons
 func (lp *launchpad) gridOn() error {
+	f := lp.newFrame()
 	for _, row := range lp.gridButtons {
 		for _, btn := range row {
-			if err := btn.ledOn(lp.userColor); err != nil {
-				return err
-			}
+			f.set(btn, lp.userColor)
 		}
 	}
-	return nil
+	return lp.flush(f)
 }
 
 // turn on all right collumn buttons
 func (lp *launchpad) rightOn() error {
 	for _, b := range lp.rightButtons {
-		if err := b.ledOn(b.color); err != nil {
+		if err := b.ledOn(b.color()); err != nil {
 			return err
 		}
 	}
@@ -516,9 +601,7 @@ func (lp *launchpad) rightOff() error {
 
 // function to turn all leds on to specified color
 func (lp *launchpad) forceAllOn() error {
-	args := append(pushArgs, fmt.Sprintf("B0 00 %d", lp.userColor))
-	cmd := exec.Command(lpCmd, args...)
-	return cmd.Run()
+	return lp.leds.send([]byte{topRow, 0x00, lp.userColor.velocity()})
 }
 
 // function to turn off all top buttons
@@ -546,9 +629,7 @@ func (lp *launchpad) allOn() error {
 
 // function to turn all leds on to specified color
 func (lp *launchpad) forceAllOff() error {
-	args := append(pushArgs, "B0 00 00")
-	cmd := exec.Command(lpCmd, args...)
-	return cmd.Run()
+	return lp.leds.reset()
 }
 
 func (lp *launchpad) allOff() error {
@@ -568,10 +649,7 @@ func (lp *launchpad) allOff() error {
 }
 
 // function to turn on any pushed leds
-func (lp *launchpad) paint() error {
-
-	// get the pressed button
-	b := lp.getBtn()
+func (lp *launchpad) paint(b *button) error {
 
 	// add color for grid button
 	if b.bType == GRID {
@@ -595,21 +673,19 @@ func (lp *launchpad) pallette() {
 	lp.userColor = defaultColor
 
 	// set right buttons as color pallette
-	lp.rightButtons[0].ledOn(0)
-	lp.rightButtons[1].ledOn(48)
-	lp.rightButtons[2].ledOn(49)
-	lp.rightButtons[3].ledOn(50)
-	lp.rightButtons[4].ledOn(51)
-	lp.rightButtons[5].ledOn(35)
-	lp.rightButtons[6].ledOn(19)
-	lp.rightButtons[7].ledOn(3)
+	lp.rightButtons[0].ledOn(off)
+	lp.rightButtons[1].ledOn(green)
+	lp.rightButtons[2].ledOn(paleGreen)
+	lp.rightButtons[3].ledOn(lime)
+	lp.rightButtons[4].ledOn(yellow)
+	lp.rightButtons[5].ledOn(amber)
+	lp.rightButtons[6].ledOn(orange)
+	lp.rightButtons[7].ledOn(red)
 
 }
 
 // function to enable LED of any button while its pushed
-func (lp *launchpad) pushTest() error {
-
-	b := lp.getBtn()
+func (lp *launchpad) pushTest(b *button) error {
 
 	if b.bType != GRID {
 		return nil
@@ -625,32 +701,35 @@ func (lp *launchpad) pushTest() error {
 
 // function to display all possible colors
 func (lp *launchpad) colorDebug() error {
-	// fill grid with colors
-	k := 0
+	lp.gridOff()
+	// fill grid with colors, green intensity down and red intensity across
 	for i := range 4 {
 		for j := range 4 {
-			lp.gridButtons[i][j].ledOn(k)
-			k++
+			lp.gridButtons[i][j].ledOn(Color{Red: uint8(j), Green: uint8(i)})
 		}
-		k += 12
 	}
-	// print pressed buttons color
-	b := lp.getBtn()
-	fmt.Printf("Dec: %d, Hex: %x\n", b.color, b.color)
+	return nil
+}
+
+// function to print the color of a pressed button
+func (lp *launchpad) printColor(b *button) error {
+	if !b.pressed {
+		return nil
+	}
+	fmt.Printf("Color: %s, Velocity: %d, Hex: %x\n", b.color(), b.color().velocity(), b.color().velocity())
 	return nil
 }
 
 // layer to execute linux cmd of button pushed
-func (lp *launchpad) macro() error {
-	lp.macroLights()
-	// get current button
-	b := lp.getBtn()
+func (lp *launchpad) macro(b *button) error {
 	if b.bType != GRID {
 		return nil
 	}
+	// relight the macros once the button is handled
+	defer lp.macroLights()
 
 	// if button has no macro
-	if b.cmd == "" {
+	if !b.bound() {
 		// enable LED when pressed
 		if b.pressed {
 			b.ledOn(lp.userColor)
@@ -663,10 +742,10 @@ func (lp *launchpad) macro() error {
 
 	// button has a macro
 
-	// run the macro when pressed
-	if b.pressed {
-		if err := b.execute(); err != nil {
-			log.Printf("Error executing macro: %v", err)
+	// run the action or macro when pressed, unless it waits to tell a tap from other gestures
+	if b.pressed && !b.gestures.delaysTap() {
+		if err := lp.runMacro(b); err != nil {
+			slog.Error("Error executing macro", "device", lp.device.id, "err", err)
 		}
 	}
 
@@ -678,9 +757,7 @@ func (lp *launchpad) macro() error {
 }
 
 // layer to set the macro of button pushed
-func (lp *launchpad) recordMacro() error {
-	// get current button
-	b := lp.getBtn()
+func (lp *launchpad) recordMacro(b *button) error {
 	if b.bType != GRID || !b.pressed {
 		return nil
 	}
@@ -688,81 +765,82 @@ func (lp *launchpad) recordMacro() error {
 	// light LED
 	go b.flash(lp.userColor, 3, 200)
 
-	// scan for input
-	c, err := getInputFromPopup()
+	// edit the pad in a terminal, the running program picks up the saved config
+	cmd, err := lp.editCommand(b)
 	if err != nil {
 		go b.flash(red, 3, 333/2)
-		return fmt.Errorf("Error getting user input: %v", err)
+		return err
 	}
-	// save command to button
-	b.cmd = c
-	b.macroColor = lp.userColor
-
-	// give approval
-	fmt.Println("Command set to: ", b.cmd)
-	defer b.flash(green, 3, 333/2)
+	if err := cmd.Start(); err != nil {
+		go b.flash(red, 3, 333/2)
+		return fmt.Errorf("Error starting macro editor, run \"launchpad edit\" in a terminal instead: %v", err)
+	}
+	slog.Info("Editing macro", "device", lp.device.id, "page", lp.page, "row", b.y, "col", b.x, "terminal", editTerminal)
 
-	// save new macros to file and return any error
-	return lp.saveMacros()
+	// the main loop keeps running while the editor is open
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			slog.Error("Error running macro editor", "device", lp.device.id, "err", err)
+			b.flash(red, 3, 333/2)
+		}
+	}()
+	return nil
 }
 
-// Function to get input from terminal
-func getInputFromPopup() (string, error) {
-	// Create a temporary file to store user input
-	tempFile, err := os.CreateTemp("", "input.txt")
+// function to get the command opening the macro editor on a pad of the shown page
+func (lp *launchpad) editCommand(b *button) (*exec.Cmd, error) {
+	self, err := os.Executable()
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("Error finding launchpad executable: %v", err)
 	}
-	defer os.Remove(tempFile.Name()) // Clean up the temp file afterwards
-
-	// Launch the kitty terminal command to read user input
-	cmd := exec.Command("kitty", "--title", "Launchpad Input", "--", "bash", "-c", fmt.Sprintf("read -p 'Enter command to save: ' userInput; echo $userInput > '%s'", tempFile.Name()))
-
-	if err := cmd.Run(); err != nil {
-		return "", err
+	edit := []string{"edit",
+		"-device", lp.device.id,
+		"-page", strconv.Itoa(lp.page),
+		"-row", strconv.Itoa(b.y),
+		"-col", strconv.Itoa(b.x),
+		"-color", lp.userColor.String()}
+	args := strings.Fields(editTerminal)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("No terminal set for the macro editor, run \"launchpad %s\" in a terminal instead", strings.Join(edit, " "))
 	}
-
-	// Read the user input from the temporary file
-	o, err := os.ReadFile(tempFile.Name())
-	if err != nil {
-		return "", err
-	}
-	out := string(o)
-
-	return strings.Trim(out, "\n"), nil
+	// arguments are passed straight to the editor, no shell gets to mangle them
+	args = append(append(args, self), edit...)
+	return exec.Command(args[0], args[1:]...), nil
 }
+
 func (lp *launchpad) drawFlower() error {
-	lp.allOff()
+	// start from a blank frame
+	f := &frame{}
 	// top, bottom and middle of flower
 	for k := range 2 {
 		// lime core
-		lp.gridButtons[2][3+k].ledOn(lime)
+		f.set(lp.gridButtons[2][3+k], lime)
 		// amber sides
-		lp.gridButtons[2][2+(3*k)].ledOn(amber)
+		f.set(lp.gridButtons[2][2+(3*k)], amber)
 
 		// green leaves
-		lp.gridButtons[5][k].ledOn(green)
-		lp.gridButtons[5][k+6].ledOn(green)
-		lp.gridButtons[6][2+(k*3)].ledOn(green)
+		f.set(lp.gridButtons[5][k], green)
+		f.set(lp.gridButtons[5][k+6], green)
+		f.set(lp.gridButtons[6][2+(k*3)], green)
 
 		// top and bottom
 		for i := range 4 {
-			lp.gridButtons[k*4][i+2].ledOn(red)
-			lp.gridButtons[k*4+(1+(k*-2))][i+2].ledOn(amber)
+			f.set(lp.gridButtons[k*4][i+2], red)
+			f.set(lp.gridButtons[k*4+(1+(k*-2))][i+2], amber)
 
 		}
 	}
 
 	for k := range 3 {
 		// red walls
-		lp.gridButtons[k+1][1].ledOn(red)
-		lp.gridButtons[k+1][6].ledOn(red)
+		f.set(lp.gridButtons[k+1][1], red)
+		f.set(lp.gridButtons[k+1][6], red)
 
 		// green stem
-		lp.gridButtons[k+5][3].ledOn(green)
-		lp.gridButtons[k+5][4].ledOn(green)
+		f.set(lp.gridButtons[k+5][3], green)
+		f.set(lp.gridButtons[k+5][4], green)
 	}
-	return nil
+	return lp.flush(f)
 }
 
 func (lp *launchpad) flashFlower() error {
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// top row buttons of the default layers
+const (
+	topFreeze  = 0
+	topPaint   = 1
+	topBreathe = 2
+	topAll     = 3
+	topMacro   = 4
+	topRecord  = 5
+	topColors  = 6
+	topLife    = 7
+)
+
+func TestMain(m *testing.M) {
+	// layers log every switch and macro, keep the test output readable
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	splashTime = 0
+	os.Exit(m.Run())
+}
+
+// function to start a simulated launchpad with a macro config, it shuts down when the test ends
+func startSim(t *testing.T, config string) (*launchpad, *simLaunchpad) {
+	t.Helper()
+	dir := t.TempDir()
+	oldDir, oldFile, oldTransport := macroDir, macroFile, transportName
+	macroDir, macroFile, transportName = dir+"/", filepath.Join(dir, "macros.toml"), simName
+	t.Cleanup(func() {
+		macroDir, macroFile, transportName = oldDir, oldFile, oldTransport
+	})
+
+	path := filepath.Join(dir, "devices", simName, "macros.toml")
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	lp, err := getLaunchpad(context.Background(), midiDevice{name: "Simulated Launchpad", id: simName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := lp.midi.(*simLaunchpad)
+	done := make(chan error, 1)
+	go func() {
+		done <- lp.start()
+	}()
+	t.Cleanup(func() {
+		lp.stop()
+		if err := <-done; err != nil {
+			t.Errorf("Error stopping launchpad: %v", err)
+		}
+	})
+	return lp, sim
+}
+
+// function to press and release a button of the simulated launchpad
+func tap(t *testing.T, sim *simLaunchpad, b *button) {
+	t.Helper()
+	if err := sim.press(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.release(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// function to wait until a condition holds, the main loop handles events in the background
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// function to wait until the LED of a button shows a color
+func waitLED(t *testing.T, sim *simLaunchpad, b *button, want Color) {
+	t.Helper()
+	waitFor(t, "LED "+b.pos().String()+" to show "+want.String(), func() bool {
+		return sim.led(b).plain() == want
+	})
+}
+
+// function to switch to a top row layer and wait until it is shown
+func switchTo(t *testing.T, lp *launchpad, sim *simLaunchpad, layer int) {
+	t.Helper()
+	tap(t, sim, lp.topButtons[layer])
+	waitFor(t, "layer switch", func() bool {
+		resp := dispatchControl(controlRequest{Command: "layer"}, []*launchpad{lp})
+		return len(resp.Lines) == 1 && strings.HasPrefix(resp.Lines[0], string(rune('0'+layer))+"\t")
+	})
+}
+
+func TestFreezeLayer(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topFreeze)
+	b := lp.gridButtons[2][3]
+
+	// the pad shows the user color while held and goes dark again when released
+	if err := sim.press(b); err != nil {
+		t.Fatal(err)
+	}
+	waitLED(t, sim, b, defaultColor)
+	if err := sim.release(b); err != nil {
+		t.Fatal(err)
+	}
+	waitLED(t, sim, b, off)
+}
+
+func TestPaintLayer(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topPaint)
+
+	// pick green from the pallette, then paint a pad which stays lit after release
+	tap(t, sim, lp.rightButtons[1])
+	b := lp.gridButtons[5][1]
+	tap(t, sim, b)
+	waitLED(t, sim, b, green)
+
+	// the off pallette button erases
+	tap(t, sim, lp.rightButtons[0])
+	tap(t, sim, b)
+	waitLED(t, sim, b, off)
+}
+
+func TestBreatheLayer(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topBreathe)
+
+	// the layer ticks in the main loop, lighting the grid from the center out
+	waitLED(t, sim, lp.gridButtons[3][3], defaultColor)
+	waitLED(t, sim, lp.gridButtons[0][0], defaultColor)
+}
+
+func TestBreatheRings(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topFreeze)
+	// pads on the innermost, second and outermost ring
+	center, middle, corner := lp.gridButtons[4][3], lp.gridButtons[2][5], lp.gridButtons[7][0]
+
+	// a layer ticked outside the main loop, checking the pads after each few ticks
+	l := &breatheLayer{lp: lp}
+	check := func(ticks int, want ...Color) {
+		t.Helper()
+		for range ticks {
+			if err := l.Tick(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i, b := range []*button{center, middle, corner} {
+			if got := sim.led(b).plain(); got != want[i] {
+				t.Errorf("at step %d pad %s shows %v, want %v", l.step, b.pos(), got, want[i])
+			}
+		}
+	}
+
+	// the grid starts off and stays off while the rings turn off and during the pause
+	if err := l.Enter(); err != nil {
+		t.Fatal(err)
+	}
+	check(0, off, off, off)
+	check(breatheRings+breathePause, off, off, off)
+
+	// the rings then light one per tick from the center out
+	check(1, defaultColor, off, off)
+	check(2, defaultColor, defaultColor, off)
+	check(1, defaultColor, defaultColor, defaultColor)
+
+	// after the second pause the rings turn off from the outside in
+	check(breathePause+1, defaultColor, defaultColor, off)
+	check(1, defaultColor, defaultColor, off)
+	check(1, defaultColor, off, off)
+	check(1, off, off, off)
+}
+
+func TestLifeLayer(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topLife)
+	run, step, clear := lp.rightButtons[automatonRun], lp.rightButtons[automatonStep], lp.rightButtons[automatonClear]
+	waitLED(t, sim, run, dimGreen)
+
+	// pressing pads makes a blinker, a step turns it on its side and ages the middle cell
+	for x := 2; x <= 4; x++ {
+		tap(t, sim, lp.gridButtons[3][x])
+		waitLED(t, sim, lp.gridButtons[3][x], defaultAgeColors[0])
+	}
+	tap(t, sim, step)
+	waitLED(t, sim, lp.gridButtons[3][3], defaultAgeColors[1])
+	for _, b := range []*button{lp.gridButtons[2][3], lp.gridButtons[4][3]} {
+		waitLED(t, sim, b, defaultAgeColors[0])
+	}
+	for _, b := range []*button{lp.gridButtons[3][2], lp.gridButtons[3][4]} {
+		waitLED(t, sim, b, off)
+	}
+
+	// running lights the control and keeps the blinker going until cleared
+	tap(t, sim, run)
+	waitLED(t, sim, run, green)
+	waitLED(t, sim, lp.gridButtons[3][2], defaultAgeColors[0])
+	tap(t, sim, clear)
+	waitLED(t, sim, run, dimGreen)
+	for _, b := range []*button{lp.gridButtons[2][3], lp.gridButtons[3][2], lp.gridButtons[3][3]} {
+		waitLED(t, sim, b, off)
+	}
+}
+
+func TestLifeKeepsPaint(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topPaint)
+	tap(t, sim, lp.rightButtons[1])
+	painted, cell := lp.gridButtons[5][1], lp.gridButtons[2][2]
+	tap(t, sim, painted)
+	waitLED(t, sim, painted, green)
+
+	// the cells replace the drawing while the layer is shown
+	switchTo(t, lp, sim, topLife)
+	waitLED(t, sim, painted, off)
+	tap(t, sim, cell)
+	waitLED(t, sim, cell, defaultAgeColors[0])
+
+	// going back shows the drawing again without the cells
+	switchTo(t, lp, sim, topPaint)
+	waitLED(t, sim, painted, green)
+	waitLED(t, sim, cell, off)
+}
+
+func TestAllLayer(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topAll)
+	for _, b := range []*button{lp.gridButtons[0][0], lp.gridButtons[4][4], lp.gridButtons[7][7]} {
+		waitLED(t, sim, b, defaultColor)
+	}
+
+	// a new color fills the grid straight away
+	tap(t, sim, lp.rightButtons[7])
+	for _, b := range []*button{lp.gridButtons[0][0], lp.gridButtons[4][4], lp.gridButtons[7][7]} {
+		waitLED(t, sim, b, red)
+	}
+}
+
+func TestMacroLayer(t *testing.T) {
+	ran := filepath.Join(t.TempDir(), "ran")
+	lp, sim := startSim(t, `version = 1
+
+[[pad]]
+row = 1
+col = 2
+cmd = "echo $LAUNCHPAD_ROW,$LAUNCHPAD_COL > `+ran+`"
+color = "red"
+`)
+	switchTo(t, lp, sim, topMacro)
+
+	// bound pads show their color, the shown page lights its right column button
+	b := lp.gridButtons[1][2]
+	waitLED(t, sim, b, red)
+	waitLED(t, sim, lp.gridButtons[0][0], off)
+	waitLED(t, sim, lp.rightButtons[0], pageColor)
+
+	// pressing the pad runs its command with its position
+	tap(t, sim, b)
+	waitFor(t, "macro command", func() bool {
+		data, err := os.ReadFile(ran)
+		return err == nil && string(data) == "1,2\n"
+	})
+	// the pad flashes green and shows its color again
+	waitLED(t, sim, b, red)
+
+	// another page has no macros
+	tap(t, sim, lp.rightButtons[3])
+	waitLED(t, sim, lp.rightButtons[3], pageColor)
+	waitLED(t, sim, b, off)
+}
+
+func TestRecordLayer(t *testing.T) {
+	// a fake terminal writes the editor arguments it is given to a file
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	terminal := filepath.Join(dir, "terminal")
+	if err := os.WriteFile(terminal, []byte("#!/bin/sh\necho \"$@\" > "+args+"\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	oldTerminal := editTerminal
+	editTerminal = terminal
+	t.Cleanup(func() {
+		editTerminal = oldTerminal
+	})
+
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topRecord)
+
+	// pressing a pad flashes it and opens the editor on it
+	b := lp.gridButtons[6][4]
+	tap(t, sim, b)
+	waitLED(t, sim, b, defaultColor)
+	waitFor(t, "macro editor", func() bool {
+		data, err := os.ReadFile(args)
+		return err == nil && strings.Contains(string(data), "edit -device sim -page 0 -row 6 -col 4 -color amber")
+	})
+	waitLED(t, sim, b, off)
+}
+
+func TestRecordLayerNoTerminal(t *testing.T) {
+	oldTerminal := editTerminal
+	editTerminal = ""
+	t.Cleanup(func() {
+		editTerminal = oldTerminal
+	})
+	lp, sim := startSim(t, "version = 1\n")
+	// the layer switch waits for the main loop to set the user color
+	switchTo(t, lp, sim, topRecord)
+
+	// without a terminal the error says which editor command to run
+	_, err := lp.editCommand(lp.gridButtons[6][4])
+	if err == nil || !strings.Contains(err.Error(), `run "launchpad edit -device sim -page 0 -row 6 -col 4 -color amber" in a terminal`) {
+		t.Errorf("editCommand returned %v, want the launchpad edit command", err)
+	}
+}
+
+func TestColorsLayer(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topColors)
+
+	// green intensity goes down the grid and red intensity across it
+	for _, c := range []struct{ row, col int }{{0, 0}, {0, 3}, {2, 1}, {3, 3}} {
+		waitLED(t, sim, lp.gridButtons[c.row][c.col], Color{Red: uint8(c.col), Green: uint8(c.row)})
+	}
+	waitLED(t, sim, lp.gridButtons[5][5], off)
+}
+
+func TestShutdownResetsLEDs(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n")
+	switchTo(t, lp, sim, topAll)
+	waitLED(t, sim, lp.gridButtons[0][0], defaultColor)
+
+	// the last message turns every LED off
+	lp.stop()
+	waitFor(t, "LED reset", func() bool {
+		sent := sim.messages()
+		return len(sent) > 0 && bytes.Equal(sent[len(sent)-1], []byte{topRow, 0x00, 0x00})
+	})
+}
+
+// function to make a macro config binding the first row to a command, colored by a number
+func rowConfig(n int) string {
+	var b strings.Builder
+	b.WriteString("version = 1\n")
+	for col := range 4 {
+		fmt.Fprintf(&b, "\n[[pad]]\nrow = 0\ncol = %d\ncmd = \"true\"\ncolor = %s\n", col, tomlQuote(rowConfigColor(n).String()))
+	}
+	return b.String()
+}
+
+// presses, config reloads, control requests and macro flashes arrive from their own
+// goroutines while the main loop owns the state, run with -race to check them
+func TestConcurrentEvents(t *testing.T) {
+	lp, sim := startSim(t, rowConfig(0))
+	switchTo(t, lp, sim, topMacro)
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for i := range 100 {
+			b := lp.gridButtons[0][i%4]
+			if err := sim.press(b); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := sim.release(b); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	})
+	wg.Go(func() {
+		for i := range 30 {
+			if err := lp.reloadMacros([]byte(rowConfig(i))); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	})
+	wg.Go(func() {
+		for i := range 100 {
+			req := []controlRequest{
+				{Command: "layer"},
+				{Command: "macros"},
+				{Command: "color", Args: []string{"7", "7", "lime"}},
+				{Command: "run", Args: []string{"0", "1"}},
+			}[i%4]
+			if resp := dispatchControl(req, []*launchpad{lp}); resp.Error != "" {
+				t.Errorf("control %s: %s", req.Command, resp.Error)
+				return
+			}
+		}
+	})
+	wg.Go(func() {
+		for range 30 {
+			lp.gridButtons[6][6].flash(red, 1, 1)
+		}
+	})
+	wg.Wait()
+
+	// the main loop still answers and ends up with the last config
+	waitFor(t, "last config", func() bool {
+		resp := dispatchControl(controlRequest{Command: "macros"}, []*launchpad{lp})
+		return len(resp.Lines) == 4 && strings.Contains(resp.Lines[0], "\t"+rowConfigColor(29).String()+"\t")
+	})
+	waitLED(t, sim, lp.gridButtons[0][0], rowConfigColor(29))
+}
+
+// function to get the color rowConfig gives its pads
+func rowConfigColor(n int) Color {
+	return []Color{red, green, amber}[n%3]
+}
+
+func TestMacroBackgroundJob(t *testing.T) {
+	lp, _ := startSim(t, "version = 1\n")
+
+	// the background job keeps the output open, the macro still finishes when the shell exits
+	done := make(chan error, 1)
+	start := time.Now()
+	if err := lp.gridButtons[0][0].runMacro("sleep 5 & echo hi", defaultExec, lp.runs, func(err error) {
+		done <- err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Macro failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the macro")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Macro took %v", elapsed)
+	}
+	waitFor(t, "macro to stop running", func() bool {
+		return lp.runs.count() == 0
+	})
+}
+
+// transport whose device can't be read, such as when it is unplugged while opening
+type brokenTransport struct{}
+
+func (brokenTransport) send(msg []byte) error           { return nil }
+func (brokenTransport) receive() (io.ReadCloser, error) { return nil, errors.New("device gone") }
+func (brokenTransport) close() error                    { return nil }
+
+func TestListenReceiveError(t *testing.T) {
+	lp, _ := startSim(t, "version = 1\n")
+
+	// the error is returned so stayConnected can reconnect instead of the program exiting
+	if err := lp.listen(brokenTransport{}); err == nil || !strings.Contains(err.Error(), "device gone") {
+		t.Errorf("listen returned %v, want the receive error", err)
+	}
+}
+
+func TestToggleDoublePress(t *testing.T) {
+	ran := filepath.Join(t.TempDir(), "ran")
+	lp, sim := startSim(t, `version = 1
+
+[[pad]]
+row = 2
+col = 2
+on = "sleep 0.2; echo on >> `+ran+`"
+off = "echo off >> `+ran+`"
+`)
+	switchTo(t, lp, sim, topMacro)
+	b := lp.gridButtons[2][2]
+	waitLED(t, sim, b, defaultOffColor)
+
+	// the second press comes while the on command is still running and is ignored
+	tap(t, sim, b)
+	tap(t, sim, b)
+	waitLED(t, sim, b, defaultOnColor)
+	time.Sleep(300 * time.Millisecond)
+	if data, _ := os.ReadFile(ran); string(data) != "on\n" {
+		t.Errorf("commands ran %q, want the on command once", data)
+	}
+
+	// once it finished the pad toggles again
+	tap(t, sim, b)
+	waitLED(t, sim, b, defaultOffColor)
+	waitFor(t, "off command", func() bool {
+		data, _ := os.ReadFile(ran)
+		return string(data) == "on\noff\n"
+	})
+}
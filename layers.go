@@ -0,0 +1,369 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// mode of the grid picked with a top row button
+type Layer interface {
+	Name() string                // name the layer is registered as
+	Enter() error                // called when the layer is switched to
+	Exit() error                 // called when another layer is switched to
+	HandleEvent(b *button) error // called for every button press and release
+	Tick() error                 // called every TickInterval while the layer is shown
+	TickInterval() time.Duration // time between ticks, 0 for layers that only react to events
+}
+
+// layer that also reacts to taps, double taps, long presses and releases of the grid pads
+type gestureLayer interface {
+	HandleGesture(g gesture) error // called for every gesture after the presses and releases making it
+}
+
+// layer with chords and shifted pads, presses of their buttons are held back until
+// the chord is complete or can't happen any more
+type chordLayer interface {
+	HandleChord(c *chordBinding) error // called instead of HandleEvent for the buttons making a chord
+}
+
+// constructors of the layers that can be put on the top row, by name
+var layerRegistry = map[string]func(lp *launchpad) Layer{}
+
+// layers of the top row when the config doesn't choose them
+var defaultLayers = []string{"freeze", "paint", "breathe", "all", "macro", "record", "colors", "life"}
+
+// function to make a layer available to the layer config
+func registerLayer(name string, newLayer func(lp *launchpad) Layer) {
+	layerRegistry[name] = newLayer
+}
+
+// built in layers
+func init() {
+	registerLayer("freeze", func(lp *launchpad) Layer {
+		return &funcLayer{name: "freeze", event: lp.freeze}
+	})
+	registerLayer("paint", func(lp *launchpad) Layer {
+		return &funcLayer{name: "paint", event: lp.paint}
+	})
+	registerLayer("breathe", func(lp *launchpad) Layer {
+		return &breatheLayer{lp: lp}
+	})
+	// redraw on every event so a new color shows straight away
+	registerLayer("all", func(lp *launchpad) Layer {
+		return &funcLayer{name: "all", enter: lp.gridOn, event: func(*button) error { return lp.gridOn() }}
+	})
+	registerLayer("macro", func(lp *launchpad) Layer {
+		return &macroLayer{lp: lp}
+	})
+	registerLayer("record", func(lp *launchpad) Layer {
+		return &recordLayer{lp: lp}
+	})
+	registerLayer("colors", func(lp *launchpad) Layer {
+		return &funcLayer{name: "colors", enter: lp.colorDebug, event: lp.printColor}
+	})
+	// cellular automata, configured by the table named after the layer
+	for name := range defaultAutomata {
+		registerLayer(name, func(lp *launchpad) Layer {
+			return newAutomatonLayer(lp, name)
+		})
+	}
+}
+
+// function to check if a layer uses the right column as its own controls instead of the color pallette
+func usesRightColumn(l Layer) bool {
+	switch l.(type) {
+	case *macroLayer, *automatonLayer:
+		return true
+	}
+	return false
+}
+
+// function to check if a layer name is registered
+func validLayer(name string) bool {
+	_, ok := layerRegistry[name]
+	return ok
+}
+
+// function to create the top row layers from their names, empty names leave a slot unused
+func (lp *launchpad) setLayers(cfg *macroConfig) {
+	lp.layers = make([]Layer, len(lp.topButtons))
+	for i, name := range configLayers(cfg) {
+		if name != "" {
+			lp.layers[i] = layerRegistry[name](lp)
+		}
+	}
+
+	// start on the first layer
+	for i, l := range lp.layers {
+		if l != nil {
+			lp.layer = i
+			break
+		}
+	}
+}
+
+// function to get the layer names a config puts on the top row, one per button
+func configLayers(cfg *macroConfig) []string {
+	names := make([]string, len(defaultLayers))
+	if cfg.layers == nil {
+		copy(names, defaultLayers)
+	} else {
+		copy(names, cfg.layers)
+	}
+	return names
+}
+
+// function to get the names of the top row layers
+func (lp *launchpad) layerNames() []string {
+	names := make([]string, len(lp.layers))
+	for i, l := range lp.layers {
+		if l != nil {
+			names[i] = l.Name()
+		}
+	}
+	return names
+}
+
+// function to get the shown layer
+func (lp *launchpad) currentLayer() Layer {
+	return lp.layers[lp.layer]
+}
+
+// timer of the shown layer's ticks
+type layerTicker struct {
+	ticker   *time.Ticker
+	interval time.Duration    // interval the ticker was started with
+	c        <-chan time.Time // nil, which never fires, for layers without ticks
+}
+
+// function to start ticking for a layer
+func newLayerTicker(l Layer) *layerTicker {
+	t := &layerTicker{interval: l.TickInterval()}
+	if interval := t.interval; interval > 0 {
+		t.ticker = time.NewTicker(interval)
+		t.c = t.ticker.C
+	}
+	return t
+}
+
+// function to stop ticking
+func (t *layerTicker) stop() {
+	if t.ticker != nil {
+		t.ticker.Stop()
+	}
+}
+
+// function to switch from one layer to another
+func (lp *launchpad) switchLayer(from, to Layer) {
+	slog.Info("Switching layer", "device", lp.device.id, "layer", lp.layer, "name", to.Name())
+	if err := from.Exit(); err != nil {
+		slog.Error("Error leaving layer", "device", lp.device.id, "layer", from.Name(), "err", err)
+	}
+	if err := to.Enter(); err != nil {
+		slog.Error("Error entering layer", "device", lp.device.id, "layer", to.Name(), "err", err)
+	}
+}
+
+// layer built from launchpad functions, nil hooks do nothing
+type funcLayer struct {
+	name  string
+	enter func() error
+	exit  func() error
+	event func(b *button) error
+	tick  func() error
+
+	interval time.Duration
+}
+
+func (l *funcLayer) Name() string {
+	return l.name
+}
+
+func (l *funcLayer) Enter() error {
+	if l.enter == nil {
+		return nil
+	}
+	return l.enter()
+}
+
+func (l *funcLayer) Exit() error {
+	if l.exit == nil {
+		return nil
+	}
+	return l.exit()
+}
+
+func (l *funcLayer) HandleEvent(b *button) error {
+	if l.event == nil {
+		return nil
+	}
+	return l.event(b)
+}
+
+func (l *funcLayer) Tick() error {
+	if l.tick == nil {
+		return nil
+	}
+	return l.tick()
+}
+
+func (l *funcLayer) TickInterval() time.Duration {
+	return l.interval
+}
+
+// layer running the macros of the shown page, the right column picks the page
+type macroLayer struct {
+	lp *launchpad
+}
+
+func (l *macroLayer) Name() string {
+	return "macro"
+}
+
+func (l *macroLayer) Enter() error {
+	l.lp.gridOff()
+	l.lp.macroLights()
+	return l.lp.pageLights()
+}
+
+func (l *macroLayer) Exit() error {
+	return l.lp.pageLightsOff()
+}
+
+func (l *macroLayer) HandleEvent(b *button) error {
+	if b.bType == RIGHT {
+		if !b.pressed {
+			return nil
+		}
+		return l.lp.setPage(b.y)
+	}
+	return l.lp.macro(b)
+}
+
+// function to run the command of a gesture, taps run the pad's macro when it waits for other gestures
+func (l *macroLayer) HandleGesture(g gesture) error {
+	b := g.button
+	if g.kind == gestureTap {
+		if b.gestures.delaysTap() {
+			return l.lp.runMacro(b)
+		}
+		return nil
+	}
+	command := b.gestures.command(g.kind)
+	if command == "" {
+		return nil
+	}
+	return b.run(command, l.lp.runs, nil)
+}
+
+// function to run the macro of a chord or shifted pad, it flashes the pad it is written on
+func (l *macroLayer) HandleChord(c *chordBinding) error {
+	pad := *c.button
+	pad.bind(c.macro)
+	return l.lp.runMacro(&pad)
+}
+
+func (l *macroLayer) Tick() error {
+	return nil
+}
+
+func (l *macroLayer) TickInterval() time.Duration {
+	return 0
+}
+
+// layer recording macros, the bound pads flash while waiting for a pad to be pressed
+type recordLayer struct {
+	lp   *launchpad
+	dark bool // the bound pads are currently hidden
+}
+
+func (l *recordLayer) Name() string {
+	return "record"
+}
+
+func (l *recordLayer) Enter() error {
+	l.dark = false
+	l.lp.gridOff()
+	return l.lp.macroLights()
+}
+
+func (l *recordLayer) Exit() error {
+	return l.lp.leds.clearOverlay()
+}
+
+func (l *recordLayer) HandleEvent(b *button) error {
+	return l.lp.recordMacro(b)
+}
+
+func (l *recordLayer) TickInterval() time.Duration {
+	return 500 * time.Millisecond
+}
+
+// function to hide or show the bound pads
+func (l *recordLayer) Tick() error {
+	l.dark = !l.dark
+	if !l.dark {
+		return l.lp.leds.clearOverlay()
+	}
+
+	// overlay hiding the macro lights without forgetting them
+	var dark frame
+	for i := range dark {
+		dark[i] = transparent
+	}
+	for _, row := range l.lp.gridButtons {
+		for _, b := range row {
+			dark.set(b, off)
+		}
+	}
+	return l.lp.leds.setOverlayFrame(&dark)
+}
+
+// layer turning the grid off outside in and back on inside out in the selected color
+type breatheLayer struct {
+	lp   *launchpad
+	step int // position in the animation, one step per tick
+}
+
+// steps of one breath, 4 rings off, a pause, 4 rings on and a pause
+const (
+	breatheRings = 4
+	breathePause = 10
+	breatheSteps = 2 * (breatheRings + breathePause)
+)
+
+func (l *breatheLayer) Name() string {
+	return "breathe"
+}
+
+func (l *breatheLayer) Enter() error {
+	l.step = 0
+	return l.lp.gridOff()
+}
+
+func (l *breatheLayer) Exit() error {
+	return nil
+}
+
+func (l *breatheLayer) HandleEvent(b *button) error {
+	return nil
+}
+
+func (l *breatheLayer) TickInterval() time.Duration {
+	return 50 * time.Millisecond
+}
+
+// function to draw the next ring of the animation
+func (l *breatheLayer) Tick() error {
+	step := l.step
+	l.step = (l.step + 1) % breatheSteps
+
+	on := breatheRings + breathePause
+	switch {
+	case step < breatheRings:
+		return l.lp.drawRing(breatheRings-1-step, off)
+	case step >= on && step < on+breatheRings:
+		return l.lp.drawRing(step-on, l.lp.userColor)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// how a macro command is run
+type execOptions struct {
+	shell   string        // shell used to run the command with -c
+	dir     string        // working directory, the home directory when empty
+	env     []string      // extra environment in KEY=value format
+	timeout time.Duration // kill the command after this long, 0 waits until it exits
+}
+
+// options used by macros that don't set their own, changed by command line flags
+var defaultExec = execOptions{shell: defaultShell()}
+
+// function to get the user's shell, falling back to /bin/sh
+func defaultShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// time the output of a macro is still read after it exits, background jobs
+// holding the output open are left running instead of delaying the result
+const outputWaitDelay = 100 * time.Millisecond
+
+// most output of a macro kept for the log, older output is dropped
+const maxMacroOutput = 64 << 10
+
+// writer keeping the last bytes written to it, so a chatty macro that runs
+// for hours can't grow memory without limit
+type tailBuffer struct {
+	buf     []byte
+	limit   int
+	dropped int // bytes dropped from the start of the output
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	// only the end of a long write fits
+	if len(p) > t.limit {
+		t.dropped += len(p) - t.limit
+		p = p[len(p)-t.limit:]
+	}
+	// make room by dropping the oldest output
+	if over := len(t.buf) + len(p) - t.limit; over > 0 {
+		t.dropped += over
+		t.buf = t.buf[:copy(t.buf, t.buf[over:])]
+	}
+	t.buf = append(t.buf, p...)
+	return n, nil
+}
+
+// function to get the kept output
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
+
+// what happens to running macro commands when the program exits
+const (
+	exitWait = "wait" // wait for them to finish, a second interrupt kills them
+	exitKill = "kill" // stop them straight away
+)
+
+// time between asking macro commands to stop and killing them
+const macroKillDelay = 2 * time.Second
+
+// macro commands of a launchpad that haven't exited yet
+type macroRuns struct {
+	mu   sync.Mutex
+	cmds map[*exec.Cmd]string // running commands and their command lines
+	wg   sync.WaitGroup
+}
+
+// function to create an empty set of running macros
+func newMacroRuns() *macroRuns {
+	return &macroRuns{cmds: map[*exec.Cmd]string{}}
+}
+
+// function to track a started command
+func (r *macroRuns) add(cmd *exec.Cmd, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cmds[cmd] = line
+	r.wg.Add(1)
+}
+
+// function to stop tracking a command once it has been reaped
+func (r *macroRuns) done(cmd *exec.Cmd) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cmds, cmd)
+	r.wg.Done()
+}
+
+// function to count the running commands
+func (r *macroRuns) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.cmds)
+}
+
+// function to signal the process group of every running command
+func (r *macroRuns) signal(sig syscall.Signal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for cmd, line := range r.cmds {
+		if err := syscall.Kill(-cmd.Process.Pid, sig); err != nil && err != syscall.ESRCH {
+			slog.Error("Error stopping macro", "cmd", line, "err", err)
+		}
+	}
+}
+
+// function to wait for or stop the running commands depending on the exit policy
+func (r *macroRuns) finish(policy string) {
+	n := r.count()
+	if n == 0 {
+		return
+	}
+	finished := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(finished)
+	}()
+
+	// wait until the commands exit or the user interrupts again, waiting is the default
+	if policy != exitKill {
+		slog.Info("Waiting for macro commands to finish, interrupt again to stop them", "count", n)
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(interrupt)
+		select {
+		case <-finished:
+			return
+		case <-interrupt:
+		}
+	}
+
+	// ask nicely first, then kill what is left
+	slog.Info("Stopping macro commands", "count", r.count())
+	r.signal(syscall.SIGTERM)
+	select {
+	case <-finished:
+		return
+	case <-time.After(macroKillDelay):
+	}
+	r.signal(syscall.SIGKILL)
+	<-finished
+}
+
+// function to start one of the buttons commands through the shell and report its exit status when it finishes
+func (b *button) runMacro(command string, opts execOptions, runs *macroRuns, done func(err error)) error {
+	// kill the command once the timeout runs out
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+	}
+
+	// the shell handles quoting, pipes, && and variables
+	cmd := exec.CommandContext(ctx, opts.shell, "-c", command)
+	cmd.Dir = opts.dir
+	cmd.Env = append(os.Environ(), opts.env...)
+	cmd.Env = append(cmd.Env, "LAUNCHPAD_ROW="+strconv.Itoa(b.y), "LAUNCHPAD_COL="+strconv.Itoa(b.x))
+
+	// run in its own process group so the timeout also kills pipelines and background jobs
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	// capture the end of stdout and stderr
+	output := &tailBuffer{limit: maxMacroOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.WaitDelay = outputWaitDelay
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+	runs.add(cmd, command)
+
+	// wait for the command so it is reaped, then show the real exit status
+	go func() {
+		defer cancel()
+		err := cmd.Wait()
+		// the command itself succeeded, only a background job kept its output open
+		if errors.Is(err, exec.ErrWaitDelay) {
+			err = nil
+		}
+		runs.done(cmd)
+		if output.dropped > 0 {
+			slog.Info("Macro output", "cmd", command, "output", output.String(), "dropped", output.dropped)
+		} else if len(output.buf) > 0 {
+			slog.Info("Macro output", "cmd", command, "output", output.String())
+		}
+		if done != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				done(ctx.Err())
+			} else {
+				done(err)
+			}
+		}
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			slog.Warn("Macro timed out", "cmd", command, "timeout", opts.timeout)
+			b.flash(red, 3, 333/2)
+		case err != nil:
+			slog.Warn("Macro failed", "cmd", command, "err", err)
+			b.flash(red, 3, 333/2)
+		default:
+			b.flash(green, 3, 333/2)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		writes  []string
+		want    string
+		dropped int
+	}{
+		{"empty", nil, "", 0},
+		{"fits", []string{"ab", "cd"}, "abcd", 0},
+		{"exactly full", []string{"abc", "def", "gh"}, "abcdefgh", 0},
+		{"drops the oldest", []string{"abcdef", "ghij"}, "cdefghij", 2},
+		{"long write keeps its end", []string{"ab", "0123456789"}, "23456789", 4},
+		{"many small writes", []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}, "cdefghij", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &tailBuffer{limit: 8}
+			for _, w := range test.writes {
+				if n, err := buf.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if buf.String() != test.want || buf.dropped != test.dropped {
+				t.Errorf("got %q with %d dropped, want %q with %d dropped", buf.String(), buf.dropped, test.want, test.dropped)
+			}
+		})
+	}
+}
+
+func TestTailBufferLimit(t *testing.T) {
+	// a macro writing far more than the limit only keeps the end
+	buf := &tailBuffer{limit: maxMacroOutput}
+	line := strings.Repeat("x", 99) + "\n"
+	for range 10000 {
+		buf.Write([]byte(line))
+	}
+	if len(buf.buf) != maxMacroOutput || buf.dropped != 10000*len(line)-maxMacroOutput {
+		t.Errorf("kept %d bytes and dropped %d", len(buf.buf), buf.dropped)
+	}
+	if cap(buf.buf) > 2*maxMacroOutput {
+		t.Errorf("buffer grew to %d bytes", cap(buf.buf))
+	}
+}
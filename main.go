@@ -1,51 +1,148 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
-// set path for the csv file containing macros
+// set path for the config file containing macros, each launchpad gets a copy under devices/<id>/
 var macroDir = ".config/launchpad/"
-var macroFile = "commands.csv"
+var macroFile = "macros.toml"
+
+// macro file of older versions, migrated to macroFile
+var legacyMacroFile = "commands.csv"
 
 // set 'amidi' as the linux command to use for communicating with the launchpad
 var lpCmd string = "amidi"
-var getArgs []string
-var pushArgs []string
 
-// LED color codes
-const off = 0
-const red = 3
-const green = 48
-const amber = 35
-const lime = 50
+// transport used to talk to the launchpad, "rawmidi", "amidi" or "sim"
+var transportName = rawmidiName
 
-// default user color
-const defaultColor = amber
+func main() {
+	// "launchpad ctl" talks to a running instance instead of starting one
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(runCtl(os.Args[2:]))
+	}
+	// "launchpad edit" edits the macros in the terminal
+	if len(os.Args) > 1 && os.Args[1] == "edit" {
+		os.Exit(runEdit(os.Args[2:]))
+	}
 
-// map of string color names to color codes
-var colors = map[string]int{"green": green, "red": red, "amber": amber, "lime": lime}
+	// parse command line flags
+	daemon := flag.Bool("daemon", false, "run as a service, logging to stderr for the journal")
+	debug := flag.Bool("debug", false, "log debug messages")
+	flag.StringVar(&controlSocket, "socket", controlSocket, "control socket for \"launchpad ctl\", empty to disable")
+	flag.StringVar(&transportName, "transport", transportName, "midi transport to use (rawmidi, amidi or sim)")
+	flag.StringVar(&defaultExec.shell, "shell", defaultExec.shell, "shell used to run macro commands")
+	flag.StringVar(&defaultExec.dir, "macro-dir", defaultExec.dir, "working directory of macro commands (default home directory)")
+	flag.DurationVar(&defaultExec.timeout, "macro-timeout", defaultExec.timeout, "kill macro commands running longer than this, 0 for no limit")
+	flag.StringVar(&editTerminal, "terminal", editTerminal, "terminal command the record layer opens the macro editor in")
+	flag.IntVar(&macroBackups, "backups", macroBackups, "number of previous macro configs kept for undo")
+	flag.Parse()
+	setupLogging(*daemon, *debug)
+
+	// a service without a display can't open the macro editor in a terminal window
+	terminalSet := false
+	flag.Visit(func(f *flag.Flag) {
+		terminalSet = terminalSet || f.Name == "terminal"
+	})
+	if *daemon && !terminalSet && !hasDisplay() {
+		slog.Info("No display for the macro editor, the record layer logs the \"launchpad edit\" command to run instead")
+		editTerminal = ""
+	}
+
+	// shut down cleanly on ctrl-c or when stopped by the service manager
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-func main() {
 	// setup config
 	if err := setConfig(); err != nil {
 		log.Fatalf("Error setting up config: %v", err)
 	}
-	// get the launchpad struct
-	fmt.Println("Getting launchpad...")
-	lp, err := getLaunchpad()
+	// find every connected launchpad
+	slog.Debug("Finding launchpads")
+	devices, err := listDevices()
 	if err != nil {
-		log.Fatalf("Error getting launchpad: %v", err)
+		log.Fatalf("Error finding launchpads: %v", err)
 	}
 
-	// start launchpad
-	if err := lp.start(); err != nil {
-		log.Fatalf("Error starting launchpad: %v", err)
+	// get a launchpad struct for each device
+	errs := make(chan error, len(devices))
+	var lps []*launchpad
+	for _, dev := range devices {
+		slog.Info("Opening launchpad", "device", dev.id, "port", dev.port)
+		lp, err := getLaunchpad(ctx, dev)
+		if err != nil {
+			// leave the launchpads started so far dark before exiting
+			stop()
+			for range lps {
+				<-errs
+			}
+			log.Fatalf("Error getting launchpad %s: %v", dev.id, err)
+		}
+
+		// drive the simulated launchpad from stdin
+		if sim, ok := lp.midi.(*simLaunchpad); ok {
+			slog.Info("Reading simulator commands from stdin")
+			go func() {
+				if err := sim.readCommands(lp, os.Stdin); err != nil {
+					slog.Error("Error reading simulator commands", "err", err)
+				}
+				// disconnect the simulated launchpad at the end of input
+				sim.close()
+			}()
+		}
+
+		// start launchpad
+		go func() {
+			errs <- lp.start()
+		}()
+		lps = append(lps, lp)
+	}
+
+	// accept requests from "launchpad ctl"
+	var control net.Listener
+	if controlSocket != "" {
+		if control, err = serveControl(controlSocket, lps); err != nil {
+			slog.Error("Control socket disabled", "err", err)
+		}
+	}
+
+	// let the service manager know we're up, and when we start stopping
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Warn("Error notifying service manager", "err", err)
 	}
+	var stopping sync.WaitGroup
+	stopping.Go(func() {
+		<-ctx.Done()
+		sdNotify("STOPPING=1")
+	})
 
+	// exit once every launchpad has shut down
+	failed := false
+	for range devices {
+		if err := <-errs; err != nil {
+			slog.Error("Error stopping launchpad", "err", err)
+			failed = true
+		}
+	}
+	if control != nil {
+		control.Close()
+	}
+	stop()
+	stopping.Wait()
+	if failed {
+		os.Exit(1)
+	}
 }
 
 // function to find / create macro command config file
@@ -55,18 +152,17 @@ func setConfig() error {
 	if err != nil {
 		return fmt.Errorf("Error finding user home dir: %v", err)
 	}
-	macroFile = homeDir + "/" + macroDir + macroFile
+	macroDir = homeDir + "/" + macroDir
+	macroFile = macroDir + macroFile
 
 	// create the file
 	if _, err := os.Stat(macroFile); errors.Is(err, os.ErrNotExist) {
-		if err := os.Mkdir(homeDir+"/"+macroDir, 0777); err != nil && !errors.Is(err, os.ErrExist) {
+		if err := os.Mkdir(macroDir, 0777); err != nil && !errors.Is(err, os.ErrExist) {
 			return fmt.Errorf("Error creating config directory: %v", err)
 		}
-		f, err := os.Create(macroFile)
-		if err != nil {
+		if err := createConfig(macroFile, macroDir+legacyMacroFile); err != nil {
 			return fmt.Errorf("Error creating config file: %v", err)
 		}
-		f.Close()
 	}
 
 	// change to home dir
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"io"
+)
+
+// midi status nibbles used by the launchpad
+const (
+	noteOff       = 0x80
+	noteOn        = 0x90
+	controlChange = 0xB0
+)
+
+// midi system status bytes
+const (
+	sysexStart = 0xF0
+	sysexEnd   = 0xF7
+	realTime   = 0xF8 // first status byte of single byte real time messages
+)
+
+// longest SysEx payload kept before the rest is dropped
+const maxSysex = 1024
+
+// decoded midi message
+type midiEvent struct {
+	status byte    // status byte including the channel
+	data   [2]byte // data bytes, unused bytes are zero
+	sysex  []byte  // SysEx payload without the F0 and F7 framing
+}
+
+// function to get the message type without the channel
+func (e midiEvent) kind() byte {
+	if e.status >= sysexStart {
+		return e.status
+	}
+	return e.status & 0xF0
+}
+
+// function to check if a note or controller message is a press, note on with velocity 0 is a release
+func (e midiEvent) pressed() bool {
+	return e.kind() != noteOff && e.data[1] != 0
+}
+
+// decoder turning a raw midi byte stream into messages
+type midiDecoder struct {
+	r       *bufio.Reader
+	running byte // running status of the last channel message
+}
+
+// function to create a decoder reading from r
+func newMidiDecoder(r io.Reader) *midiDecoder {
+	return &midiDecoder{r: bufio.NewReader(r)}
+}
+
+// function to read the next complete midi message, malformed bytes are skipped
+func (d *midiDecoder) next() (midiEvent, error) {
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return midiEvent{}, err
+		}
+
+		switch {
+		// real time messages can appear anywhere and carry nothing we use
+		case c >= realTime:
+			continue
+
+		// SysEx message
+		case c == sysexStart:
+			d.running = 0
+			return d.readSysex()
+
+		// stray end of SysEx
+		case c == sysexEnd:
+			continue
+
+		// system common messages cancel running status
+		case c > sysexStart:
+			d.running = 0
+			ev := midiEvent{status: c}
+			ok, err := d.readData(&ev, commonLength(c))
+			if err != nil {
+				return midiEvent{}, err
+			}
+			if ok {
+				return ev, nil
+			}
+
+		// channel message
+		case c >= noteOff:
+			d.running = c
+			ev := midiEvent{status: c}
+			ok, err := d.readData(&ev, channelLength(c))
+			if err != nil {
+				return midiEvent{}, err
+			}
+			if ok {
+				return ev, nil
+			}
+
+		// data byte using running status
+		case d.running != 0:
+			d.r.UnreadByte()
+			ev := midiEvent{status: d.running}
+			ok, err := d.readData(&ev, channelLength(d.running))
+			if err != nil {
+				return midiEvent{}, err
+			}
+			if ok {
+				return ev, nil
+			}
+
+			// data byte without a status, skip it
+		}
+	}
+}
+
+// function to read n data bytes into an event, returns false if a new status byte cut the message short
+func (d *midiDecoder) readData(ev *midiEvent, n int) (bool, error) {
+	for i := 0; i < n; {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		if c >= realTime {
+			continue
+		}
+		if c >= noteOff {
+			// leave the status byte for the next message
+			d.r.UnreadByte()
+			return false, nil
+		}
+		ev.data[i] = c
+		i++
+	}
+	return true, nil
+}
+
+// function to read a SysEx payload up to the closing F7
+func (d *midiDecoder) readSysex() (midiEvent, error) {
+	ev := midiEvent{status: sysexStart}
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return midiEvent{}, err
+		}
+		if c >= realTime {
+			continue
+		}
+		if c == sysexEnd {
+			return ev, nil
+		}
+		if c >= noteOff {
+			// unterminated SysEx, keep what was read and start the next message
+			d.r.UnreadByte()
+			return ev, nil
+		}
+		if len(ev.sysex) < maxSysex {
+			ev.sysex = append(ev.sysex, c)
+		}
+	}
+}
+
+// function to get the number of data bytes of a channel message
+func channelLength(status byte) int {
+	switch status & 0xF0 {
+	case 0xC0, 0xD0:
+		return 1
+	}
+	return 2
+}
+
+// function to get the number of data bytes of a system common message
+func commonLength(status byte) int {
+	switch status {
+	case 0xF1, 0xF3:
+		return 1
+	case 0xF2:
+		return 2
+	}
+	return 0
+}
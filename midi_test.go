@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+// function to decode every complete message in a byte stream
+func decodeAll(t *testing.T, data []byte) []midiEvent {
+	t.Helper()
+	decoder := newMidiDecoder(bytes.NewReader(data))
+	var events []midiEvent
+	for {
+		ev, err := decoder.next()
+		if errors.Is(err, io.EOF) {
+			return events
+		}
+		if err != nil {
+			t.Fatalf("Error decoding % X: %v", data, err)
+		}
+		events = append(events, ev)
+	}
+}
+
+// function to create a channel message event
+func channelEvent(status, d1, d2 byte) midiEvent {
+	return midiEvent{status: status, data: [2]byte{d1, d2}}
+}
+
+func TestMidiDecoder(t *testing.T) {
+	longSysex := append([]byte{sysexStart}, bytes.Repeat([]byte{0x01}, maxSysex+10)...)
+	longSysex = append(longSysex, sysexEnd)
+
+	tests := []struct {
+		name string
+		in   []byte
+		want []midiEvent
+	}{
+		{"note on", []byte{0x90, 0x3C, 0x7F}, []midiEvent{channelEvent(0x90, 0x3C, 0x7F)}},
+		{"running status", []byte{0x90, 0x3C, 0x7F, 0x3D, 0x00, 0x3E, 0x40}, []midiEvent{
+			channelEvent(0x90, 0x3C, 0x7F), channelEvent(0x90, 0x3D, 0x00), channelEvent(0x90, 0x3E, 0x40),
+		}},
+		{"running status after a controller", []byte{0xB0, 0x68, 0x7F, 0x68, 0x00}, []midiEvent{
+			channelEvent(0xB0, 0x68, 0x7F), channelEvent(0xB0, 0x68, 0x00),
+		}},
+		{"one data byte", []byte{0xC0, 0x05, 0x06}, []midiEvent{channelEvent(0xC0, 0x05, 0), channelEvent(0xC0, 0x06, 0)}},
+		{"sysex", []byte{0xF0, 0x00, 0x20, 0x29, 0xF7, 0x90, 0x01, 0x7F}, []midiEvent{
+			{status: sysexStart, sysex: []byte{0x00, 0x20, 0x29}}, channelEvent(0x90, 0x01, 0x7F),
+		}},
+		{"sysex cut short by a status byte", []byte{0xF0, 0x00, 0x20, 0x90, 0x01, 0x7F}, []midiEvent{
+			{status: sysexStart, sysex: []byte{0x00, 0x20}}, channelEvent(0x90, 0x01, 0x7F),
+		}},
+		{"sysex cancels running status", []byte{0x90, 0x01, 0x7F, 0xF0, 0x01, 0xF7, 0x02, 0x7F}, []midiEvent{
+			channelEvent(0x90, 0x01, 0x7F), {status: sysexStart, sysex: []byte{0x01}},
+		}},
+		{"long sysex is truncated", longSysex, []midiEvent{{status: sysexStart, sysex: bytes.Repeat([]byte{0x01}, maxSysex)}}},
+		{"real time inside a message", []byte{0x90, 0xF8, 0x3C, 0xFE, 0x7F}, []midiEvent{channelEvent(0x90, 0x3C, 0x7F)}},
+		{"real time inside sysex", []byte{0xF0, 0x01, 0xF8, 0x02, 0xF7}, []midiEvent{{status: sysexStart, sysex: []byte{0x01, 0x02}}}},
+		{"real time between messages", []byte{0xFA, 0x90, 0x01, 0x02, 0xFC}, []midiEvent{channelEvent(0x90, 0x01, 0x02)}},
+		{"stray data bytes", []byte{0x3C, 0x7F, 0x90, 0x01, 0x02}, []midiEvent{channelEvent(0x90, 0x01, 0x02)}},
+		{"stray end of sysex", []byte{0xF7, 0x90, 0x01, 0x02}, []midiEvent{channelEvent(0x90, 0x01, 0x02)}},
+		{"message cut short by a status byte", []byte{0x90, 0x3C, 0xB0, 0x68, 0x7F}, []midiEvent{channelEvent(0xB0, 0x68, 0x7F)}},
+		{"system common cancels running status", []byte{0x90, 0x01, 0x02, 0xF6, 0x03, 0x04}, []midiEvent{
+			channelEvent(0x90, 0x01, 0x02), {status: 0xF6},
+		}},
+		{"system common with data", []byte{0xF2, 0x01, 0x02, 0xF3, 0x05}, []midiEvent{channelEvent(0xF2, 0x01, 0x02), channelEvent(0xF3, 0x05, 0)}},
+		{"incomplete message at the end", []byte{0x90, 0x01, 0x02, 0x90, 0x03}, []midiEvent{channelEvent(0x90, 0x01, 0x02)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := decodeAll(t, test.in)
+			if !slices.EqualFunc(got, test.want, func(a, b midiEvent) bool {
+				return a.status == b.status && a.data == b.data && bytes.Equal(a.sysex, b.sysex)
+			}) {
+				t.Errorf("decoding % X\n got %+v\nwant %+v", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMidiEventPressed(t *testing.T) {
+	tests := []struct {
+		ev   midiEvent
+		want bool
+	}{
+		{channelEvent(0x90, 0x00, 0x7F), true},
+		{channelEvent(0x90, 0x00, 0x00), false},
+		{channelEvent(0x80, 0x00, 0x7F), false},
+		{channelEvent(0xB0, 0x68, 0x7F), true},
+		{channelEvent(0xB0, 0x68, 0x00), false},
+	}
+	for _, test := range tests {
+		if got := test.ev.pressed(); got != test.want {
+			t.Errorf("%+v pressed() = %t, want %t", test.ev, got, test.want)
+		}
+	}
+}
+
+func FuzzMidiDecoder(f *testing.F) {
+	for _, seed := range [][]byte{
+		{0x90, 0x3C, 0x7F, 0x3D, 0x00},
+		{0xF0, 0x00, 0x20, 0x29, 0xF7},
+		{0xF0, 0x00, 0x90, 0x01, 0x7F},
+		{0x90, 0xF8, 0x3C, 0xFE, 0x7F},
+		{0x3C, 0xF7, 0xF6, 0xF2, 0x01},
+		{0xB0, 0x68, 0x7F, 0xC0, 0x05},
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decoder := newMidiDecoder(bytes.NewReader(data))
+		for {
+			ev, err := decoder.next()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Fatalf("Unexpected error decoding % X: %v", data, err)
+				}
+				return
+			}
+			// only real messages come out, never real time, stray ends of SysEx or data bytes
+			if ev.status < noteOff || ev.status == sysexEnd || ev.status >= realTime {
+				t.Fatalf("Invalid status %02X decoding % X", ev.status, data)
+			}
+			for _, c := range ev.data {
+				if c >= noteOff {
+					t.Fatalf("Invalid data byte %02X decoding % X", c, data)
+				}
+			}
+			for _, c := range ev.sysex {
+				if c >= noteOff {
+					t.Fatalf("Invalid SysEx byte %02X decoding % X", c, data)
+				}
+			}
+			if len(ev.sysex) > maxSysex {
+				t.Fatalf("SysEx of %d bytes decoding % X", len(ev.sysex), data)
+			}
+			if ev.sysex != nil && ev.status != sysexStart {
+				t.Fatalf("SysEx payload on status %02X decoding % X", ev.status, data)
+			}
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// number of macro pages, one per right column button
+const macroPages = 8
+
+// LED color of the right column button of the shown macro page
+var pageColor = green
+
+// command or action bound to a grid pad on one macro page
+type macroBinding struct {
+	cmd      string          // linux command executed when the pad gets pressed
+	action   string          // built in action run instead of a command
+	gestures gestureCommands // commands of the other gestures
+	toggle   toggleCommands  // on and off commands run in turn instead of cmd
+	color    Color           // LED color of the pad
+	label    string          // short description of the macro
+	options  *execOptions    // how the command is run, nil uses defaultExec
+}
+
+// function to get the macro bound to a button
+func (b *button) binding() macroBinding {
+	return macroBinding{cmd: b.cmd, action: b.action, gestures: b.gestures, toggle: b.toggle, color: b.macroColor, label: b.label, options: b.options}
+}
+
+// function to bind a macro to a button
+func (b *button) bind(m macroBinding) {
+	b.cmd, b.action, b.gestures, b.toggle, b.macroColor, b.label, b.options = m.cmd, m.action, m.gestures, m.toggle, m.color, m.label, m.options
+}
+
+// function to check if the binding has a command, action, gesture command or toggle
+func (m macroBinding) bound() bool {
+	return m.cmd != "" || m.action != "" || m.gestures.any() || m.toggle.any()
+}
+
+// function to show a macro page on the grid
+func (lp *launchpad) loadPage(page int) {
+	lp.page = page
+	for i, row := range lp.gridButtons {
+		for j, b := range row {
+			b.bind(lp.pages[page][i][j])
+			// toggle pads show their state
+			if b.toggle.any() {
+				b.macroColor = b.toggle.color(lp.toggles[[3]int{page, i, j}])
+			}
+		}
+	}
+}
+
+// function to switch the grid to another macro page
+func (lp *launchpad) setPage(page int) error {
+	if page < 0 || page >= macroPages {
+		return fmt.Errorf("Macro page %d out of range 0-%d", page, macroPages-1)
+	}
+	lp.loadPage(page)
+	slog.Info("Switching macro page", "device", lp.device.id, "page", page)
+
+	// light the new page's macros
+	lp.gridOff()
+	lp.macroLights()
+	return lp.pageLights()
+}
+
+// function to light the right column button of the shown page over the color pallette
+func (lp *launchpad) pageLights() error {
+	for i, b := range lp.rightButtons {
+		color := off
+		if i == lp.page {
+			color = pageColor
+		}
+		if err := b.overlayOn(color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function to show the color pallette in the right column again
+func (lp *launchpad) pageLightsOff() error {
+	for _, b := range lp.rightButtons {
+		if err := b.overlayOff(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import "strings"
+
+// novation SysEx header shared by the MK2 and X
+var novationSysex = []byte{sysexStart, 0x00, 0x20, 0x29, 0x02}
+
+// device specific addressing, colors and setup of a launchpad model.
+// Colors are given as launchpad S red/green intensities and converted by the profile.
+type deviceProfile interface {
+	name() string                           // model name
+	padIndex(ev midiEvent) int              // frame index of a button message, -1 for other messages
+	ledMessage(i int, color Color) []byte   // message setting the LED at a frame index
+	frameMessage(f *frame) []byte           // messages drawing a whole frame in one step
+	init() []byte                           // messages putting a newly connected device in the expected mode
+	reset() []byte                          // messages turning every LED off
+	padNote(i int) (status byte, note byte) // status and note a button at a frame index sends
+}
+
+// function to pick the profile of a device from its midi name
+func profileFor(name string) deviceProfile {
+	switch {
+	case strings.Contains(name, "MK2"):
+		return &launchpadMK2{}
+	case strings.Contains(name, "Launchpad X"), strings.Contains(name, "LPX"):
+		return &launchpadX{}
+	}
+	// the Mini uses the same protocol as the S
+	return &launchpadS{}
+}
+
+// function to get the top to bottom row and left to right column of a frame index, column 8 is the right column
+func frameRowCol(i int) (int, int) {
+	switch {
+	case i < 64:
+		return i / 8, i % 8
+	case i < 72:
+		return i - 64, 8
+	}
+	return -1, i - 72
+}
+
+// launchpad S control values sent with controller 0
+const (
+	bufferSelect = 0x20 // base value for selecting display and update buffers
+	bufferUpdate = 0x04 // shift of the update buffer bit
+	rapidUpdate  = 0x92 // note on channel 3 sets two LEDs per message
+)
+
+// launchpad S and Mini: note per pad in X-Y layout, red/green velocity colors and double buffering
+type launchpadS struct {
+	displayBuffer int // LED buffer (0 or 1) currently shown by the launchpad
+}
+
+// function to get the model name
+func (p *launchpadS) name() string {
+	return "Launchpad S"
+}
+
+// function to get the frame index of a launchpad S button message
+func (p *launchpadS) padIndex(ev midiEvent) int {
+	switch ev.kind() {
+	// top row buttons are controllers 0x68-0x6F
+	case controlChange:
+		i := int(ev.data[0]) - 0x68
+		if i < 0 || i >= 8 {
+			return -1
+		}
+		return 72 + i
+
+	// grid and right column buttons are notes, row in the high nibble and column in the low nibble
+	case noteOn, noteOff:
+		row, col := int(ev.data[0]>>4), int(ev.data[0]&0x0F)
+		if row >= 8 || col > 8 {
+			return -1
+		}
+		if col == 8 {
+			return 64 + row
+		}
+		return row*8 + col
+	}
+	return -1
+}
+
+// function to get the status and note of the launchpad S button at a frame index
+func (p *launchpadS) padNote(i int) (byte, byte) {
+	row, col := frameRowCol(i)
+	if row < 0 {
+		return topRow, byte(0x68 + col)
+	}
+	return gridRow, byte(row*16 + col)
+}
+
+// function to set one LED with a red/green velocity
+func (p *launchpadS) ledMessage(i int, color Color) []byte {
+	status, note := p.padNote(i)
+	return []byte{status, note, color.velocity()}
+}
+
+// function to draw a frame into the hidden buffer and flip it into view in one step
+func (p *launchpadS) frameMessage(f *frame) []byte {
+	hidden := 1 - p.displayBuffer
+
+	// keep showing the current buffer while writing to the hidden one,
+	// this also resets the rapid update cursor to the first grid pad
+	msg := []byte{topRow, 0x00, byte(bufferSelect | hidden*bufferUpdate | p.displayBuffer)}
+
+	// rapid update sets two LEDs per message
+	for i := 0; i < frameSize; i += 2 {
+		msg = append(msg, rapidUpdate, f[i].velocity(), f[i+1].velocity())
+	}
+
+	// display the hidden buffer and send later single LED updates to it as well
+	msg = append(msg, topRow, 0x00, byte(bufferSelect|hidden*bufferUpdate|hidden))
+	p.displayBuffer = hidden
+	return msg
+}
+
+// function to select the X-Y layout, a newly connected launchpad shows and updates buffer 0
+func (p *launchpadS) init() []byte {
+	p.displayBuffer = 0
+	return []byte{topRow, 0x00, 0x01}
+}
+
+// function to reset the launchpad, which also selects buffer 0
+func (p *launchpadS) reset() []byte {
+	p.displayBuffer = 0
+	return []byte{topRow, 0x00, 0x00}
+}
+
+// launchpad MK2 in session layout: pads numbered 11-89 from the bottom left and a 128 color palette
+type launchpadMK2 struct{}
+
+// function to get the model name
+func (p *launchpadMK2) name() string {
+	return "Launchpad MK2"
+}
+
+// function to get the frame index of a launchpad MK2 button message
+func (p *launchpadMK2) padIndex(ev midiEvent) int {
+	switch ev.kind() {
+	// top row buttons are controllers 104-111
+	case controlChange:
+		i := int(ev.data[0]) - 104
+		if i < 0 || i >= 8 {
+			return -1
+		}
+		return 72 + i
+
+	// grid and right column buttons are notes 11-89
+	case noteOn, noteOff:
+		return decimalIndex(ev.data[0])
+	}
+	return -1
+}
+
+// function to get the status and note of the launchpad MK2 button at a frame index
+func (p *launchpadMK2) padNote(i int) (byte, byte) {
+	row, col := frameRowCol(i)
+	if row < 0 {
+		return controlChange, byte(104 + col)
+	}
+	return noteOn, decimalNote(row, col)
+}
+
+// function to set one LED with a palette color
+func (p *launchpadMK2) ledMessage(i int, color Color) []byte {
+	status, note := p.padNote(i)
+	return []byte{status, note, mk2Palette(color)}
+}
+
+// function to set every LED with one SysEx message
+func (p *launchpadMK2) frameMessage(f *frame) []byte {
+	msg := append([]byte(nil), novationSysex...)
+	msg = append(msg, 0x18, 0x0A)
+	for i, color := range f {
+		_, note := p.padNote(i)
+		msg = append(msg, note, mk2Palette(color))
+	}
+	return append(msg, sysexEnd)
+}
+
+// function to select the session layout
+func (p *launchpadMK2) init() []byte {
+	msg := append([]byte(nil), novationSysex...)
+	return append(msg, 0x18, 0x22, 0x00, sysexEnd)
+}
+
+// function to turn every LED off
+func (p *launchpadMK2) reset() []byte {
+	msg := append([]byte(nil), novationSysex...)
+	return append(msg, 0x18, 0x0E, 0x00, sysexEnd)
+}
+
+// function to get the closest MK2 palette color to a launchpad S color
+func mk2Palette(color Color) byte {
+	r, g := color.Red, color.Green
+	level := max(r, g)
+	if level == 0 {
+		return 0
+	}
+	// each palette hue has a bright, mid and dim entry
+	dim := 3 - level
+	switch {
+	case g == 0:
+		return 5 + dim // red
+	case r == 0:
+		return 21 + dim // green
+	case r > g:
+		return 9 + dim // orange
+	case r == g:
+		return 13 + dim // yellow
+	}
+	return 17 + dim // lime
+}
+
+// launchpad X in programmer mode: pads numbered 11-99 from the bottom left and SysEx RGB colors
+type launchpadX struct{}
+
+// function to get the model name
+func (p *launchpadX) name() string {
+	return "Launchpad X"
+}
+
+// function to get the frame index of a launchpad X button message
+func (p *launchpadX) padIndex(ev midiEvent) int {
+	switch ev.kind() {
+	// top row buttons are controllers 91-98 and the right column controllers 19-89
+	case controlChange:
+		n := int(ev.data[0])
+		if n >= 91 && n <= 98 {
+			return 72 + n - 91
+		}
+		return decimalIndex(ev.data[0])
+
+	// grid buttons are notes 11-88
+	case noteOn, noteOff:
+		return decimalIndex(ev.data[0])
+	}
+	return -1
+}
+
+// function to get the status and note of the launchpad X button at a frame index
+func (p *launchpadX) padNote(i int) (byte, byte) {
+	row, col := frameRowCol(i)
+	switch {
+	case row < 0:
+		return controlChange, byte(91 + col)
+	case col == 8:
+		return controlChange, decimalNote(row, col)
+	}
+	return noteOn, decimalNote(row, col)
+}
+
+// function to set one LED with an RGB color
+func (p *launchpadX) ledMessage(i int, color Color) []byte {
+	return p.rgbMessage([]int{i}, func(int) Color { return color })
+}
+
+// function to set every LED with one SysEx message
+func (p *launchpadX) frameMessage(f *frame) []byte {
+	indexes := make([]int, frameSize)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return p.rgbMessage(indexes, func(i int) Color { return f[i] })
+}
+
+// function to build an RGB lighting SysEx message for LEDs at frame indexes
+func (p *launchpadX) rgbMessage(indexes []int, color func(int) Color) []byte {
+	msg := append([]byte(nil), novationSysex...)
+	msg = append(msg, 0x0C, 0x03)
+	for _, i := range indexes {
+		_, note := p.padNote(i)
+		c := color(i)
+		// lighting type 3 is RGB with 0-127 channels
+		msg = append(msg, 0x03, note, c.Red*42, c.Green*42, 0)
+	}
+	return append(msg, sysexEnd)
+}
+
+// function to enter programmer mode
+func (p *launchpadX) init() []byte {
+	msg := append([]byte(nil), novationSysex...)
+	return append(msg, 0x0C, 0x0E, 0x01, sysexEnd)
+}
+
+// function to turn every LED off
+func (p *launchpadX) reset() []byte {
+	return p.frameMessage(&frame{})
+}
+
+// function to get the pad number of a row and column on the MK2 and X, counted from 11 at the bottom left
+func decimalNote(row, col int) byte {
+	return byte((8-row)*10 + col + 1)
+}
+
+// function to get the frame index of a MK2 or X pad number, -1 outside the grid and right column
+func decimalIndex(note byte) int {
+	row, col := 8-int(note)/10, int(note)%10-1
+	if row < 0 || row >= 8 || col < 0 || col > 8 {
+		return -1
+	}
+	if col == 8 {
+		return 64 + row
+	}
+	return row*8 + col
+}
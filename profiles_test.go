@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// every supported launchpad model
+var profiles = []deviceProfile{&launchpadS{}, &launchpadMK2{}, &launchpadX{}}
+
+func TestProfileFor(t *testing.T) {
+	tests := map[string]string{
+		"Launchpad S":                  "Launchpad S",
+		"Launchpad Mini MIDI 1":        "Launchpad S",
+		"Launchpad MK2 MIDI 1":         "Launchpad MK2",
+		"Launchpad X LPX MIDI In":      "Launchpad X",
+		"LPX MIDI":                     "Launchpad X",
+		"Some other MIDI controller 1": "Launchpad S",
+	}
+	for device, want := range tests {
+		if got := profileFor(device).name(); got != want {
+			t.Errorf("profileFor(%q) = %s, want %s", device, got, want)
+		}
+	}
+}
+
+func TestDecimalNote(t *testing.T) {
+	tests := []struct {
+		row, col int
+		note     byte
+		index    int
+	}{
+		{row: 7, col: 0, note: 11, index: 56},
+		{row: 7, col: 7, note: 18, index: 63},
+		{row: 0, col: 0, note: 81, index: 0},
+		{row: 0, col: 7, note: 88, index: 7},
+		{row: 3, col: 5, note: 56, index: 29},
+		{row: 0, col: 8, note: 89, index: 64},
+		{row: 7, col: 8, note: 19, index: 71},
+	}
+	for _, test := range tests {
+		if got := decimalNote(test.row, test.col); got != test.note {
+			t.Errorf("decimalNote(%d, %d) = %d, want %d", test.row, test.col, got, test.note)
+		}
+		if got := decimalIndex(test.note); got != test.index {
+			t.Errorf("decimalIndex(%d) = %d, want %d", test.note, got, test.index)
+		}
+	}
+
+	// notes outside the grid and right column, the X top row is 91-98 but is sent as controllers
+	for _, note := range []byte{0, 1, 9, 10, 20, 80, 90, 91, 98, 99, 127} {
+		if got := decimalIndex(note); got != -1 {
+			t.Errorf("decimalIndex(%d) = %d, want -1", note, got)
+		}
+	}
+}
+
+func TestProfileRoundTrip(t *testing.T) {
+	for _, p := range profiles {
+		seen := map[[2]byte]int{}
+		for i := range frameSize {
+			status, note := p.padNote(i)
+			if prev, ok := seen[[2]byte{status, note}]; ok {
+				t.Errorf("%s: pads %d and %d both send %02X %d", p.name(), prev, i, status, note)
+			}
+			seen[[2]byte{status, note}] = i
+
+			// a press and a release of the pad map back to its frame index
+			if got := p.padIndex(channelEvent(status, note, 127)); got != i {
+				t.Errorf("%s: pad %d sends %02X %d which maps to %d", p.name(), i, status, note, got)
+			}
+			release := channelEvent(status, note, 0)
+			if status == noteOn {
+				release = channelEvent(noteOff, note, 0)
+			}
+			if got := p.padIndex(release); got != i {
+				t.Errorf("%s: release of pad %d maps to %d", p.name(), i, got)
+			}
+		}
+	}
+}
+
+func TestProfilePadNote(t *testing.T) {
+	tests := []struct {
+		p      deviceProfile
+		i      int
+		status byte
+		note   byte
+	}{
+		// the S numbers pads in X-Y layout, row in the high nibble
+		{&launchpadS{}, 0, gridRow, 0x00},
+		{&launchpadS{}, 63, gridRow, 0x77},
+		{&launchpadS{}, 66, gridRow, 0x28},
+		{&launchpadS{}, 72, topRow, 0x68},
+		{&launchpadS{}, 79, topRow, 0x6F},
+
+		// the MK2 numbers pads from the bottom left with the top row on controllers 104-111
+		{&launchpadMK2{}, 0, noteOn, 81},
+		{&launchpadMK2{}, 56, noteOn, 11},
+		{&launchpadMK2{}, 64, noteOn, 89},
+		{&launchpadMK2{}, 71, noteOn, 19},
+		{&launchpadMK2{}, 72, controlChange, 104},
+		{&launchpadMK2{}, 79, controlChange, 111},
+
+		// the X sends its right column and top row as controllers
+		{&launchpadX{}, 0, noteOn, 81},
+		{&launchpadX{}, 63, noteOn, 18},
+		{&launchpadX{}, 64, controlChange, 89},
+		{&launchpadX{}, 71, controlChange, 19},
+		{&launchpadX{}, 72, controlChange, 91},
+		{&launchpadX{}, 79, controlChange, 98},
+	}
+	for _, test := range tests {
+		status, note := test.p.padNote(test.i)
+		if status != test.status || note != test.note {
+			t.Errorf("%s: padNote(%d) = %02X %d, want %02X %d", test.p.name(), test.i, status, note, test.status, test.note)
+		}
+	}
+}
+
+func TestProfilePadIndexOther(t *testing.T) {
+	tests := []struct {
+		p  deviceProfile
+		ev midiEvent
+	}{
+		{&launchpadS{}, channelEvent(controlChange, 0x67, 127)},
+		{&launchpadS{}, channelEvent(controlChange, 0x70, 127)},
+		{&launchpadS{}, channelEvent(noteOn, 0x09, 127)},
+		{&launchpadS{}, channelEvent(noteOn, 0x80, 127)},
+		{&launchpadS{}, channelEvent(0xE0, 0x00, 0x40)},
+		{&launchpadMK2{}, channelEvent(controlChange, 103, 127)},
+		{&launchpadMK2{}, channelEvent(controlChange, 112, 127)},
+		{&launchpadMK2{}, channelEvent(noteOn, 10, 127)},
+		{&launchpadMK2{}, channelEvent(noteOn, 90, 127)},
+		{&launchpadX{}, channelEvent(controlChange, 90, 127)},
+		{&launchpadX{}, channelEvent(controlChange, 99, 127)},
+		{&launchpadX{}, channelEvent(controlChange, 10, 127)},
+		{&launchpadX{}, channelEvent(noteOn, 99, 127)},
+		{&launchpadX{}, midiEvent{status: sysexStart, sysex: []byte{0x00, 0x20, 0x29}}},
+	}
+	for _, test := range tests {
+		if got := test.p.padIndex(test.ev); got != -1 {
+			t.Errorf("%s: padIndex(%02X %d) = %d, want -1", test.p.name(), test.ev.status, test.ev.data[0], got)
+		}
+	}
+}
+
+func TestMK2Palette(t *testing.T) {
+	tests := []struct {
+		color Color
+		want  byte
+	}{
+		{off, 0},
+		{red, 5},
+		{Color{Red: 2}, 6},
+		{dimRed, 7},
+		{orange, 9},
+		{amber, 9},
+		{yellow, 13},
+		{dimYellow, 15},
+		{lime, 17},
+		{paleGreen, 17},
+		{green, 21},
+		{dimGreen, 23},
+		// the S buffer flags don't change the color
+		{Color{Red: 3, Copy: true, Clear: true}, 5},
+	}
+	for _, test := range tests {
+		if got := mk2Palette(test.color); got != test.want {
+			t.Errorf("mk2Palette(%v) = %d, want %d", test.color, got, test.want)
+		}
+	}
+}
+
+// function to frame a novation SysEx message around a payload
+func novationMessage(payload ...byte) []byte {
+	msg := append([]byte(nil), novationSysex...)
+	msg = append(msg, payload...)
+	return append(msg, sysexEnd)
+}
+
+func TestProfileLedMessage(t *testing.T) {
+	tests := []struct {
+		p     deviceProfile
+		i     int
+		color Color
+		want  []byte
+	}{
+		{&launchpadS{}, 0, orange, []byte{gridRow, 0x00, 0x13}},
+		{&launchpadS{}, 66, Color{Green: 3, Copy: true}, []byte{gridRow, 0x28, 0x34}},
+		{&launchpadS{}, 75, red, []byte{topRow, 0x6B, 0x03}},
+		{&launchpadMK2{}, 56, red, []byte{noteOn, 11, 5}},
+		{&launchpadMK2{}, 64, green, []byte{noteOn, 89, 21}},
+		{&launchpadMK2{}, 72, yellow, []byte{controlChange, 104, 13}},
+		{&launchpadX{}, 56, orange, novationMessage(0x0C, 0x03, 0x03, 11, 126, 42, 0)},
+		{&launchpadX{}, 64, off, novationMessage(0x0C, 0x03, 0x03, 89, 0, 0, 0)},
+		{&launchpadX{}, 79, green, novationMessage(0x0C, 0x03, 0x03, 98, 0, 126, 0)},
+	}
+	for _, test := range tests {
+		if got := test.p.ledMessage(test.i, test.color); !bytes.Equal(got, test.want) {
+			t.Errorf("%s: ledMessage(%d, %v) = % X, want % X", test.p.name(), test.i, test.color, got, test.want)
+		}
+	}
+}
+
+// function to make a frame with a different color on neighbouring pads
+func testFrame() *frame {
+	var f frame
+	for i := range f {
+		f[i] = Color{Red: uint8(i % 4), Green: uint8(i / 4 % 4)}
+	}
+	return &f
+}
+
+func TestLaunchpadSFrameMessage(t *testing.T) {
+	p, f := &launchpadS{}, testFrame()
+	if got := p.init(); !bytes.Equal(got, []byte{topRow, 0x00, 0x01}) {
+		t.Errorf("init() = % X", got)
+	}
+
+	// the frame is written to the hidden buffer, which is then shown, flipping each time
+	for _, buffers := range [][2]byte{{0x24, 0x25}, {0x21, 0x20}, {0x24, 0x25}} {
+		msg := p.frameMessage(f)
+		if len(msg) != 3+frameSize/2*3+3 {
+			t.Fatalf("frame message is %d bytes", len(msg))
+		}
+		if !bytes.Equal(msg[:3], []byte{topRow, 0x00, buffers[0]}) || !bytes.Equal(msg[len(msg)-3:], []byte{topRow, 0x00, buffers[1]}) {
+			t.Errorf("buffer selects % X and % X, want %02X and %02X", msg[:3], msg[len(msg)-3:], buffers[0], buffers[1])
+		}
+		// rapid updates set two LEDs in frame order
+		for i := 0; i < frameSize; i += 2 {
+			at := 3 + i/2*3
+			if want := []byte{rapidUpdate, f[i].velocity(), f[i+1].velocity()}; !bytes.Equal(msg[at:at+3], want) {
+				t.Errorf("rapid update of pads %d and %d = % X, want % X", i, i+1, msg[at:at+3], want)
+			}
+		}
+	}
+
+	// a reset shows buffer 0 again
+	if got := p.reset(); !bytes.Equal(got, []byte{topRow, 0x00, 0x00}) {
+		t.Errorf("reset() = % X", got)
+	}
+	if got := p.frameMessage(f); got[2] != 0x24 {
+		t.Errorf("frame after a reset selects %02X, want 24", got[2])
+	}
+}
+
+func TestLaunchpadMK2FrameMessage(t *testing.T) {
+	p, f := &launchpadMK2{}, testFrame()
+	msg := p.frameMessage(f)
+	header := append(append([]byte(nil), novationSysex...), 0x18, 0x0A)
+	if len(msg) != len(header)+frameSize*2+1 || !bytes.HasPrefix(msg, header) || msg[len(msg)-1] != sysexEnd {
+		t.Fatalf("frame message % X isn't one SysEx setting %d LEDs", msg, frameSize)
+	}
+	// note and palette color pairs in frame order
+	for i := range frameSize {
+		at := len(header) + i*2
+		_, note := p.padNote(i)
+		if want := []byte{note, mk2Palette(f[i])}; !bytes.Equal(msg[at:at+2], want) {
+			t.Errorf("pad %d = % X, want % X", i, msg[at:at+2], want)
+		}
+	}
+
+	if got, want := p.init(), novationMessage(0x18, 0x22, 0x00); !bytes.Equal(got, want) {
+		t.Errorf("init() = % X, want % X", got, want)
+	}
+	if got, want := p.reset(), novationMessage(0x18, 0x0E, 0x00); !bytes.Equal(got, want) {
+		t.Errorf("reset() = % X, want % X", got, want)
+	}
+}
+
+func TestLaunchpadXFrameMessage(t *testing.T) {
+	p, f := &launchpadX{}, testFrame()
+	msg := p.frameMessage(f)
+	header := append(append([]byte(nil), novationSysex...), 0x0C, 0x03)
+	if len(msg) != len(header)+frameSize*5+1 || !bytes.HasPrefix(msg, header) || msg[len(msg)-1] != sysexEnd {
+		t.Fatalf("frame message % X isn't one SysEx setting %d LEDs", msg, frameSize)
+	}
+	// RGB specs in frame order, the S intensities scaled to 0-126
+	for i := range frameSize {
+		at := len(header) + i*5
+		_, note := p.padNote(i)
+		if want := []byte{0x03, note, f[i].Red * 42, f[i].Green * 42, 0}; !bytes.Equal(msg[at:at+5], want) {
+			t.Errorf("pad %d = % X, want % X", i, msg[at:at+5], want)
+		}
+	}
+
+	if got, want := p.init(), novationMessage(0x0C, 0x0E, 0x01); !bytes.Equal(got, want) {
+		t.Errorf("init() = % X, want % X", got, want)
+	}
+	// a reset draws an empty frame
+	if got, want := p.reset(), p.frameMessage(&frame{}); !bytes.Equal(got, want) {
+		t.Errorf("reset() = % X, want % X", got, want)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import "sync"
+
+// overlay color that lets the persistent color show through, outside the valid 0-3 intensity range
+var transparent = Color{Red: 0xFF, Green: 0xFF}
+
+// changed LEDs above which a whole double buffered frame is sent instead of single messages
+const rapidThreshold = 4
+
+// LED state of the launchpad, a temporary overlay composited over the persistent colors
+type renderer struct {
+	mu         sync.Mutex
+	midi       transport     // connection used for LED output, nil while disconnected
+	profile    deviceProfile // addressing and colors of the launchpad model
+	persistent frame         // saved LED colors
+	overlay    frame         // temporary colors drawn over the persistent colors
+	shown      frame         // colors last sent to the launchpad
+	synced     bool          // false when shown may not match the launchpad
+}
+
+// function to create a disconnected renderer with no overlay
+func newRenderer(profile deviceProfile) *renderer {
+	r := &renderer{profile: profile}
+	for i := range r.overlay {
+		r.overlay[i] = transparent
+	}
+	return r
+}
+
+// function to set the persistent color of one LED
+func (r *renderer) set(i int, color Color) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.persistent[i] = color
+	return r.render()
+}
+
+// function to set the temporary color of one LED, transparent removes it
+func (r *renderer) setOverlay(i int, color Color) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overlay[i] = color
+	return r.render()
+}
+
+// function to get the persistent color of one LED
+func (r *renderer) color(i int) Color {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.persistent[i]
+}
+
+// function to get a copy of the persistent colors
+func (r *renderer) frame() *frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.persistent
+	return &f
+}
+
+// function to replace the persistent colors
+func (r *renderer) setFrame(f *frame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.persistent = *f
+	return r.render()
+}
+
+// function to replace the temporary colors
+func (r *renderer) setOverlayFrame(f *frame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overlay = *f
+	return r.render()
+}
+
+// function to remove every temporary color
+func (r *renderer) clearOverlay() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.overlay {
+		r.overlay[i] = transparent
+	}
+	return r.render()
+}
+
+// function to switch to a new connection and redraw every LED on it, nil stops output
+func (r *renderer) setMidi(midi transport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.midi = midi
+	r.synced = false
+	if midi == nil {
+		return nil
+	}
+	// put the newly connected launchpad in the expected mode
+	if err := midi.send(r.profile.init()); err != nil {
+		return err
+	}
+	return r.render()
+}
+
+// function to send messages changing LEDs outside the renderer, every LED is resent on the next render
+func (r *renderer) send(msg []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.synced = false
+	if r.midi == nil {
+		return nil
+	}
+	return r.midi.send(msg)
+}
+
+// function to close the connection, later LED changes are only kept in memory
+func (r *renderer) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.midi == nil {
+		return nil
+	}
+	err := r.midi.close()
+	r.midi = nil
+	return err
+}
+
+// function to resend every LED on the next render
+func (r *renderer) invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.synced = false
+}
+
+// function to reset the launchpad, turning every LED off
+func (r *renderer) reset() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.midi == nil {
+		return nil
+	}
+	if err := r.midi.send(r.profile.reset()); err != nil {
+		r.synced = false
+		return err
+	}
+	r.shown = frame{}
+	r.synced = true
+	return nil
+}
+
+// function to get the colors the launchpad should show
+func (r *renderer) composite() frame {
+	f := r.persistent
+	for i, c := range r.overlay {
+		if c != transparent {
+			f[i] = c
+		}
+	}
+	return f
+}
+
+// function to send the LEDs that changed since the last render, must hold the lock
+func (r *renderer) render() error {
+	// remember the state until a launchpad is connected
+	if r.midi == nil {
+		return nil
+	}
+	want := r.composite()
+
+	// find changed LEDs
+	var changed []int
+	for i := range want {
+		if !r.synced || want[i] != r.shown[i] {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	// send a whole frame so larger changes appear in one step
+	if len(changed) > rapidThreshold {
+		if err := r.midi.send(r.profile.frameMessage(&want)); err != nil {
+			r.synced = false
+			return err
+		}
+	} else {
+		var msg []byte
+		for _, i := range changed {
+			msg = append(msg, r.profile.ledMessage(i, want[i])...)
+		}
+		if err := r.midi.send(msg); err != nil {
+			r.synced = false
+			return err
+		}
+	}
+
+	r.shown = want
+	r.synced = true
+	return nil
+}
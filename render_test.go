@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// function to create a launchpad S renderer drawing on a simulated device
+func simRenderer(t *testing.T) (*renderer, *simLaunchpad) {
+	t.Helper()
+	r, sim := newRenderer(&launchpadS{}), newSimLaunchpad()
+	if err := r.setMidi(sim); err != nil {
+		t.Fatal(err)
+	}
+	return r, sim
+}
+
+// function to get the messages sent by a renderer change
+func sentBy(t *testing.T, sim *simLaunchpad, change func() error) [][]byte {
+	t.Helper()
+	before := len(sim.messages())
+	if err := change(); err != nil {
+		t.Fatal(err)
+	}
+	return sim.messages()[before:]
+}
+
+// function to get the color the simulated device shows at a frame index
+func simLED(sim *simLaunchpad, i int) Color {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	status, note := (&launchpadS{}).padNote(i)
+	return sim.leds[[2]byte{status, note}]
+}
+
+func TestRenderChangedOnly(t *testing.T) {
+	r, sim := simRenderer(t)
+
+	// only the changed pad is sent
+	got := sentBy(t, sim, func() error { return r.set(5, red) })
+	if !slices.EqualFunc(got, [][]byte{{gridRow, 0x05, red.velocity()}}, bytes.Equal) {
+		t.Errorf("setting one pad sent % X", got)
+	}
+
+	// setting the same colors again sends nothing
+	if got := sentBy(t, sim, func() error { return r.set(5, red) }); len(got) != 0 {
+		t.Errorf("setting an unchanged pad sent % X", got)
+	}
+	if got := sentBy(t, sim, func() error { return r.setFrame(r.frame()) }); len(got) != 0 {
+		t.Errorf("setting an unchanged frame sent % X", got)
+	}
+
+	// a frame with a few changes sends those pads in frame order
+	f := r.frame()
+	f[5], f[64], f[79] = off, green, amber
+	got = sentBy(t, sim, func() error { return r.setFrame(f) })
+	want := [][]byte{{gridRow, 0x05, off.velocity()}, {gridRow, 0x08, green.velocity()}, {topRow, 0x6F, amber.velocity()}}
+	if !slices.EqualFunc(got, want, bytes.Equal) {
+		t.Errorf("setting 3 pads sent % X, want % X", got, want)
+	}
+}
+
+func TestRenderOverlay(t *testing.T) {
+	r, sim := simRenderer(t)
+	if err := r.set(10, green); err != nil {
+		t.Fatal(err)
+	}
+
+	// the overlay is shown over the persistent color without replacing it
+	if err := r.setOverlay(10, red); err != nil {
+		t.Fatal(err)
+	}
+	if simLED(sim, 10) != red || r.color(10) != green {
+		t.Errorf("overlay shows %v with persistent %v, want red over green", simLED(sim, 10), r.color(10))
+	}
+
+	// persistent changes under the overlay stay hidden
+	if got := sentBy(t, sim, func() error { return r.set(10, amber) }); len(got) != 0 {
+		t.Errorf("change under the overlay sent % X", got)
+	}
+
+	// removing the overlay shows the persistent color again
+	if err := r.setOverlay(10, transparent); err != nil {
+		t.Fatal(err)
+	}
+	if simLED(sim, 10) != amber {
+		t.Errorf("cleared overlay shows %v, want amber", simLED(sim, 10))
+	}
+
+	// an overlay of off hides a lit pad until the whole overlay is cleared
+	for _, i := range []int{10, 11} {
+		if err := r.setOverlay(i, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if simLED(sim, 10) != off {
+		t.Errorf("off overlay shows %v", simLED(sim, 10))
+	}
+	got := sentBy(t, sim, r.clearOverlay)
+	if !slices.EqualFunc(got, [][]byte{{gridRow, 0x12, amber.velocity()}}, bytes.Equal) {
+		t.Errorf("clearing the overlay sent % X, want only the pad it hid", got)
+	}
+}
+
+func TestRenderRapidThreshold(t *testing.T) {
+	r, sim := simRenderer(t)
+
+	// up to rapidThreshold changes are sent one by one
+	var f frame
+	for i := range rapidThreshold {
+		f[i] = red
+	}
+	if got := sentBy(t, sim, func() error { return r.setFrame(&f) }); len(got) != rapidThreshold {
+		t.Errorf("%d changes sent %d messages, want one per pad", rapidThreshold, len(got))
+	}
+
+	// more are sent as one double buffered frame: buffer select, rapid updates, buffer flip
+	for i := range rapidThreshold + 1 {
+		f[i] = green
+	}
+	got := sentBy(t, sim, func() error { return r.setFrame(&f) })
+	if len(got) != frameSize/2+2 || got[0][0] != topRow || got[1][0] != rapidUpdate || got[len(got)-1][0] != topRow {
+		t.Fatalf("%d changes sent % X, want one frame", rapidThreshold+1, got)
+	}
+	for i := range frameSize {
+		if simLED(sim, i) != f[i] {
+			t.Errorf("pad %d shows %v, want %v", i, simLED(sim, i), f[i])
+		}
+	}
+
+	// after outside changes every pad is resent
+	r.invalidate()
+	f[0] = amber
+	if got := sentBy(t, sim, func() error { return r.setFrame(&f) }); len(got) != frameSize/2+2 {
+		t.Errorf("change after invalidate sent %d messages, want a whole frame", len(got))
+	}
+}
+
+func TestRenderDisconnected(t *testing.T) {
+	r, sim := newRenderer(&launchpadS{}), newSimLaunchpad()
+
+	// changes are kept until a launchpad is connected, which then gets every pad
+	if err := r.set(3, red); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.setOverlay(4, green); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.setMidi(sim); err != nil {
+		t.Fatal(err)
+	}
+	if got := sim.messages(); len(got) != 1+frameSize/2+2 || !bytes.Equal(got[0], []byte{topRow, 0x00, 0x01}) {
+		t.Errorf("connecting sent % X, want init and a whole frame", got)
+	}
+	if simLED(sim, 3) != red || simLED(sim, 4) != green {
+		t.Errorf("connected launchpad shows %v and %v, want red and green", simLED(sim, 3), simLED(sim, 4))
+	}
+}
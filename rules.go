@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// rule advancing the cells of an automaton one generation
+type automatonRule interface {
+	step(g *cellGrid) bool // advance one generation, false once nothing more can happen
+	reset()                // forget state kept outside the cells, such as the ant
+	String() string        // rule as written in the config
+}
+
+// cells of an automaton by row and column
+type cellGrid struct {
+	cells [8][8]int // age of each cell in generations, 0 for dead cells
+	wrap  bool      // edges wrap around, making the grid a torus
+}
+
+// function to check if the cell at a position is alive, positions off the grid are dead unless they wrap
+func (g *cellGrid) alive(y, x int) bool {
+	if g.wrap {
+		y, x = (y+8)%8, (x+8)%8
+	} else if y < 0 || y > 7 || x < 0 || x > 7 {
+		return false
+	}
+	return g.cells[y][x] > 0
+}
+
+// function to count the live cells around a cell
+func (g *cellGrid) neighbours(y, x int) int {
+	n := 0
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if (dy != 0 || dx != 0) && g.alive(y+dy, x+dx) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// function to parse a rule: B/S notation such as "B3/S23", "ant" for Langton's Ant
+// or an elementary 1-D rule such as "rule30"
+func parseRule(s string) (automatonRule, error) {
+	rule := strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case rule == "ant":
+		return &antRule{}, nil
+	case strings.HasPrefix(rule, "rule"):
+		n, err := strconv.Atoi(strings.TrimPrefix(rule, "rule"))
+		if err != nil || n < 0 || n > 255 {
+			return nil, fmt.Errorf("elementary rule %q must be rule0 to rule255", s)
+		}
+		return &elementaryRule{number: byte(n)}, nil
+	}
+	return parseTotalistic(rule, s)
+}
+
+// outer totalistic rule such as Life (B3/S23), HighLife (B36/S23) or Seeds (B2/S)
+type totalisticRule struct {
+	birth   [9]bool // dead cells with this many live neighbours come alive
+	survive [9]bool // live cells with this many live neighbours stay alive
+}
+
+// function to parse lower case B/S notation, the parts may come in either order
+func parseTotalistic(rule, s string) (*totalisticRule, error) {
+	r := &totalisticRule{}
+	parts := strings.Split(rule, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("unknown rule %q, use B/S notation such as \"B3/S23\", \"ant\" or \"rule30\"", s)
+	}
+	seen := map[byte]bool{}
+	for _, part := range parts {
+		if part == "" || (part[0] != 'b' && part[0] != 's') || seen[part[0]] {
+			return nil, fmt.Errorf("rule %q needs one B and one S part such as \"B3/S23\"", s)
+		}
+		seen[part[0]] = true
+		counts := &r.birth
+		if part[0] == 's' {
+			counts = &r.survive
+		}
+		for _, c := range part[1:] {
+			if c < '0' || c > '8' {
+				return nil, fmt.Errorf("rule %q has neighbour count %q, counts are 0-8", s, c)
+			}
+			counts[c-'0'] = true
+		}
+	}
+	return r, nil
+}
+
+func (r *totalisticRule) step(g *cellGrid) bool {
+	var next [8][8]int
+	alive := false
+	for y := range g.cells {
+		for x, age := range g.cells[y] {
+			n := g.neighbours(y, x)
+			switch {
+			case age > 0 && r.survive[n]:
+				next[y][x] = age + 1
+			case age == 0 && r.birth[n]:
+				next[y][x] = 1
+			}
+			alive = alive || next[y][x] > 0
+		}
+	}
+	g.cells = next
+	return alive
+}
+
+func (r *totalisticRule) reset() {}
+
+func (r *totalisticRule) String() string {
+	var b strings.Builder
+	b.WriteString("B")
+	for n, ok := range r.birth {
+		if ok {
+			b.WriteString(strconv.Itoa(n))
+		}
+	}
+	b.WriteString("/S")
+	for n, ok := range r.survive {
+		if ok {
+			b.WriteString(strconv.Itoa(n))
+		}
+	}
+	return b.String()
+}
+
+// directions the ant can face, clockwise from up
+var antMoves = [4][2]int{{-1, 0}, {0, 1}, {1, 0}, {0, -1}}
+
+// Langton's Ant, which turns right on dead cells and left on live ones, flipping each cell it leaves
+type antRule struct {
+	placed bool // the ant is on the grid
+	y, x   int  // position of the ant
+	dir    int  // index into antMoves
+}
+
+func (r *antRule) step(g *cellGrid) bool {
+	if !r.placed {
+		r.placed, r.y, r.x, r.dir = true, 3, 3, 0
+	}
+	// turn right on dead cells and left on live ones
+	dir := (r.dir + 1) % 4
+	if g.cells[r.y][r.x] > 0 {
+		dir = (r.dir + 3) % 4
+	}
+
+	// without wrapping the ant stops at the edge, leaving the grid as it is
+	y, x := r.y+antMoves[dir][0], r.x+antMoves[dir][1]
+	if g.wrap {
+		y, x = (y+8)%8, (x+8)%8
+	} else if y < 0 || y > 7 || x < 0 || x > 7 {
+		return false
+	}
+
+	// flip the cell and move on
+	if g.cells[r.y][r.x] > 0 {
+		g.cells[r.y][r.x] = 0
+	} else {
+		g.cells[r.y][r.x] = 1
+	}
+	r.y, r.x, r.dir = y, x, dir
+	return true
+}
+
+func (r *antRule) reset() {
+	r.placed = false
+}
+
+func (r *antRule) String() string {
+	return "ant"
+}
+
+// elementary 1-D rule, new generations appear in the top row and older ones scroll down
+type elementaryRule struct {
+	number byte // Wolfram code, bit n gives the next state of a cell whose neighbourhood reads n
+}
+
+func (r *elementaryRule) step(g *cellGrid) bool {
+	var row [8]int
+	alive := false
+	for x := range row {
+		n := 0
+		for _, dx := range []int{-1, 0, 1} {
+			n <<= 1
+			if g.alive(0, x+dx) {
+				n |= 1
+			}
+		}
+		if r.number>>n&1 == 1 {
+			row[x] = 1
+			alive = true
+		}
+	}
+
+	// age the older generations as they move down
+	for y := 7; y > 0; y-- {
+		for x := range g.cells[y] {
+			g.cells[y][x] = 0
+			if age := g.cells[y-1][x]; age > 0 {
+				g.cells[y][x] = age + 1
+				alive = true
+			}
+		}
+	}
+	g.cells[0] = row
+	return alive
+}
+
+func (r *elementaryRule) reset() {}
+
+func (r *elementaryRule) String() string {
+	return fmt.Sprintf("rule%d", r.number)
+}
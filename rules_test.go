@@ -0,0 +1,369 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// function to make a grid from 8 rows of 8 characters, # for live cells and . for dead ones
+func gridFrom(t *testing.T, wrap bool, rows ...string) *cellGrid {
+	t.Helper()
+	if len(rows) != 8 {
+		t.Fatalf("grid has %d rows, want 8", len(rows))
+	}
+	g := &cellGrid{wrap: wrap}
+	for y, row := range rows {
+		if len(row) != 8 {
+			t.Fatalf("grid row %d has %d cells, want 8", y, len(row))
+		}
+		for x, c := range row {
+			if c == '#' {
+				g.cells[y][x] = 1
+			}
+		}
+	}
+	return g
+}
+
+// function to draw the live cells of a grid the way gridFrom reads them
+func gridRows(g *cellGrid) string {
+	var b strings.Builder
+	for y := range g.cells {
+		for x := range g.cells[y] {
+			if g.cells[y][x] > 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// function to check the live cells of a grid
+func checkGrid(t *testing.T, step string, g *cellGrid, want ...string) {
+	t.Helper()
+	if got, want := gridRows(g), strings.Join(want, "\n")+"\n"; got != want {
+		t.Errorf("%s: got\n%swant\n%s", step, got, want)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "B3/S23", want: "B3/S23"},
+		{in: "b36/s23", want: "B36/S23"},
+		{in: "S23/B3", want: "B3/S23"},
+		{in: " B2/S ", want: "B2/S"},
+		{in: "B/S012345678", want: "B/S012345678"},
+		{in: "B33/S2", want: "B3/S2"},
+		{in: "Ant", want: "ant"},
+		{in: "rule30", want: "rule30"},
+		{in: "Rule0", want: "rule0"},
+		{in: "rule255", want: "rule255"},
+		{in: "B9/S", err: `rule "B9/S" has neighbour count '9', counts are 0-8`},
+		{in: "B3/S2x", err: `rule "B3/S2x" has neighbour count 'x', counts are 0-8`},
+		{in: "B3/B3", err: `rule "B3/B3" needs one B and one S part`},
+		{in: "B3/", err: `rule "B3/" needs one B and one S part`},
+		{in: "X3/S23", err: `rule "X3/S23" needs one B and one S part`},
+		{in: "B3", err: `unknown rule "B3", use B/S notation`},
+		{in: "B3/S23/S1", err: `unknown rule "B3/S23/S1"`},
+		{in: "", err: `unknown rule ""`},
+		{in: "rule256", err: `elementary rule "rule256" must be rule0 to rule255`},
+		{in: "rule-1", err: `elementary rule "rule-1" must be rule0 to rule255`},
+		{in: "rulex", err: `elementary rule "rulex" must be rule0 to rule255`},
+	}
+	for _, test := range tests {
+		rule, err := parseRule(test.in)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("parseRule(%q) returned %v, want %q", test.in, err, test.err)
+			}
+			continue
+		}
+		if err != nil || rule.String() != test.want {
+			t.Errorf("parseRule(%q) = %v, %v, want %q", test.in, rule, err, test.want)
+		}
+	}
+}
+
+// function to parse a rule, failing the test when it is invalid
+func mustRule(t *testing.T, s string) automatonRule {
+	t.Helper()
+	rule, err := parseRule(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func TestLifeBlinker(t *testing.T) {
+	life := mustRule(t, "B3/S23")
+	vertical := []string{
+		"........",
+		"........",
+		"........",
+		"#.......",
+		"#.......",
+		"#.......",
+		"........",
+		"........",
+	}
+
+	// on the torus the blinker at the edge wraps around and keeps blinking
+	g := gridFrom(t, true, vertical...)
+	for range 2 {
+		if !life.step(g) {
+			t.Fatal("blinker died on the torus")
+		}
+		checkGrid(t, "horizontal", g,
+			"........",
+			"........",
+			"........",
+			"........",
+			"##.....#",
+			"........",
+			"........",
+			"........",
+		)
+		life.step(g)
+		checkGrid(t, "vertical", g, vertical...)
+	}
+	// the middle cell survives every generation and keeps aging
+	if age := g.cells[4][0]; age != 5 {
+		t.Errorf("middle cell is %d generations old, want 5", age)
+	}
+
+	// on the bounded grid it loses the cells off the edge and dies out
+	g = gridFrom(t, false, vertical...)
+	if !life.step(g) {
+		t.Fatal("blinker died in the first generation")
+	}
+	checkGrid(t, "cut short", g,
+		"........",
+		"........",
+		"........",
+		"........",
+		"##......",
+		"........",
+		"........",
+		"........",
+	)
+	if life.step(g) {
+		t.Error("step reported live cells on an empty grid")
+	}
+}
+
+func TestLifeGlider(t *testing.T) {
+	life := mustRule(t, "B3/S23")
+	glider := []string{
+		".#......",
+		"..#.....",
+		"###.....",
+		"........",
+		"........",
+		"........",
+		"........",
+		"........",
+	}
+
+	// the glider moves one cell down and right every 4 generations, so it is back after 32 on the torus
+	g := gridFrom(t, true, glider...)
+	for range 4 {
+		life.step(g)
+	}
+	checkGrid(t, "after 4", g,
+		"........",
+		"..#.....",
+		"...#....",
+		".###....",
+		"........",
+		"........",
+		"........",
+		"........",
+	)
+	for range 28 {
+		if !life.step(g) {
+			t.Fatal("glider died on the torus")
+		}
+	}
+	checkGrid(t, "after 32", g, glider...)
+
+	// on the bounded grid it crashes into the corner and settles as a block
+	g = gridFrom(t, false, glider...)
+	for range 32 {
+		life.step(g)
+	}
+	block := []string{
+		"........",
+		"........",
+		"........",
+		"........",
+		"........",
+		"........",
+		"......##",
+		"......##",
+	}
+	checkGrid(t, "crashed", g, block...)
+	life.step(g)
+	checkGrid(t, "still", g, block...)
+}
+
+func TestSeeds(t *testing.T) {
+	// every live cell dies, dead cells with exactly 2 live neighbours are born
+	seeds := mustRule(t, "B2/S")
+	g := gridFrom(t, false,
+		"........",
+		"........",
+		"........",
+		"...##...",
+		"........",
+		"........",
+		"........",
+		"........",
+	)
+	seeds.step(g)
+	checkGrid(t, "generation 1", g,
+		"........",
+		"........",
+		"...##...",
+		"........",
+		"...##...",
+		"........",
+		"........",
+		"........",
+	)
+	seeds.step(g)
+	checkGrid(t, "generation 2", g,
+		"........",
+		"...##...",
+		"........",
+		"..#..#..",
+		"........",
+		"...##...",
+		"........",
+		"........",
+	)
+}
+
+func TestAnt(t *testing.T) {
+	ant := &antRule{}
+	g := &cellGrid{wrap: false}
+
+	// it starts in the middle facing up, turning right on dead cells and flipping each cell it leaves
+	for i, want := range []struct{ y, x, dir int }{{3, 4, 1}, {4, 4, 2}, {4, 3, 3}, {3, 3, 0}} {
+		if !ant.step(g) {
+			t.Fatalf("step %d stopped", i)
+		}
+		if ant.y != want.y || ant.x != want.x || ant.dir != want.dir {
+			t.Errorf("step %d: ant at %d,%d facing %d, want %d,%d facing %d", i, ant.y, ant.x, ant.dir, want.y, want.x, want.dir)
+		}
+	}
+	// back on a live cell it turns left and flips it off
+	ant.step(g)
+	if ant.y != 3 || ant.x != 2 || ant.dir != 3 {
+		t.Errorf("ant at %d,%d facing %d, want 3,2 facing left", ant.y, ant.x, ant.dir)
+	}
+	checkGrid(t, "after 5 steps", g,
+		"........",
+		"........",
+		"........",
+		"....#...",
+		"...##...",
+		"........",
+		"........",
+		"........",
+	)
+
+	// reset puts it back in the middle on the next step
+	ant.reset()
+	ant.step(g)
+	if ant.y != 3 || ant.x != 4 || ant.dir != 1 {
+		t.Errorf("ant at %d,%d facing %d after reset, want 3,4 facing right", ant.y, ant.x, ant.dir)
+	}
+}
+
+func TestAntEdge(t *testing.T) {
+	// facing left on a dead cell of the top row, it turns right and walks off the top
+	edge := antRule{placed: true, y: 0, x: 3, dir: 3}
+
+	// the bounded grid stops it without changing anything
+	ant, g := edge, &cellGrid{wrap: false}
+	if ant.step(g) {
+		t.Error("ant walked off the bounded grid")
+	}
+	if ant != edge || g.cells != ([8][8]int{}) {
+		t.Errorf("stopped ant changed the grid or moved to %d,%d", ant.y, ant.x)
+	}
+
+	// the torus brings it in at the bottom
+	ant, g = edge, &cellGrid{wrap: true}
+	if !ant.step(g) {
+		t.Error("ant stopped on the torus")
+	}
+	if ant.y != 7 || ant.x != 3 || ant.dir != 0 || g.cells[0][3] != 1 {
+		t.Errorf("ant at %d,%d facing %d, cell %d, want 7,3 facing up with the cell flipped", ant.y, ant.x, ant.dir, g.cells[0][3])
+	}
+}
+
+func TestElementaryRule30(t *testing.T) {
+	rule30 := mustRule(t, "rule30")
+	g := gridFrom(t, false,
+		"....#...",
+		"........",
+		"........",
+		"........",
+		"........",
+		"........",
+		"........",
+		"........",
+	)
+
+	// new generations appear in the top row and older ones scroll down
+	rule30.step(g)
+	rule30.step(g)
+	checkGrid(t, "generation 2", g,
+		"..##..#.",
+		"...###..",
+		"....#...",
+		"........",
+		"........",
+		"........",
+		"........",
+		"........",
+	)
+	// cells age as they scroll
+	if g.cells[0][2] != 1 || g.cells[1][3] != 2 || g.cells[2][4] != 3 {
+		t.Errorf("ages %d, %d, %d, want 1, 2, 3", g.cells[0][2], g.cells[1][3], g.cells[2][4])
+	}
+
+	// the edges only wrap on the torus
+	for _, test := range []struct {
+		wrap bool
+		want string
+	}{{false, "##......"}, {true, "##.....#"}} {
+		g := gridFrom(t, test.wrap, "#.......", "........", "........", "........", "........", "........", "........", "........")
+		rule30.step(g)
+		if got := strings.SplitN(gridRows(g), "\n", 2)[0]; got != test.want {
+			t.Errorf("wrap %t: top row %s, want %s", test.wrap, got, test.want)
+		}
+	}
+}
+
+func TestElementaryDiesOut(t *testing.T) {
+	// rule0 never makes a cell, the last one scrolls off after 8 generations
+	rule0 := mustRule(t, "rule0")
+	g := gridFrom(t, false, "...#....", "........", "........", "........", "........", "........", "........", "........")
+	for i := range 7 {
+		if !rule0.step(g) {
+			t.Fatalf("died after %d generations", i+1)
+		}
+	}
+	if rule0.step(g) {
+		t.Error("still alive after the last cell scrolled off")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// in-memory launchpad S that records LED messages and injects button events
+type simLaunchpad struct {
+	mu     sync.Mutex
+	sent   [][]byte          // every message sent to the device, in order
+	leds   map[[2]byte]Color // current LED color keyed by status and note
+	rapid  int               // frame index of the next rapid update LED
+	input  *io.PipeReader    // read end handed to listen
+	events *io.PipeWriter    // write end used to inject button events
+}
+
+// function to create a simulated launchpad
+func newSimLaunchpad() *simLaunchpad {
+	r, w := io.Pipe()
+	return &simLaunchpad{leds: map[[2]byte]Color{}, input: r, events: w}
+}
+
+// function to record midi messages sent to the simulated device
+func (s *simLaunchpad) send(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	decoder := newMidiDecoder(bytes.NewReader(msg))
+	for {
+		ev, err := decoder.next()
+		if err != nil {
+			return nil
+		}
+		s.sent = append(s.sent, []byte{ev.status, ev.data[0], ev.data[1]})
+
+		// rapid update fills LEDs in frame order
+		if ev.status == rapidUpdate {
+			for _, c := range ev.data {
+				if s.rapid < frameSize {
+					status, note := (&launchpadS{}).padNote(s.rapid)
+					s.leds[[2]byte{status, note}] = velocityColor(c)
+					s.rapid++
+				}
+			}
+			continue
+		}
+		// any other message resets the rapid update cursor
+		s.rapid = 0
+		s.leds[[2]byte{ev.status, ev.data[0]}] = velocityColor(ev.data[1])
+	}
+}
+
+// function to get the stream of injected button events
+func (s *simLaunchpad) receive() (io.ReadCloser, error) {
+	return s.input, nil
+}
+
+// function to stop the simulated device
+func (s *simLaunchpad) close() error {
+	return s.events.Close()
+}
+
+// function to get a copy of every message sent so far
+func (s *simLaunchpad) messages() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.sent...)
+}
+
+// function to get the current LED color of a button
+func (s *simLaunchpad) led(b *button) Color {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leds[[2]byte{byte(b.row), b.note()}]
+}
+
+// function to inject a press of a button
+func (s *simLaunchpad) press(b *button) error {
+	return s.inject(byte(b.row), b.note(), 0x7F)
+}
+
+// function to inject a release of a button
+func (s *simLaunchpad) release(b *button) error {
+	return s.inject(byte(b.row), b.note(), 0x00)
+}
+
+// function to write a raw midi message as if the device sent it
+func (s *simLaunchpad) inject(status, note, velocity byte) error {
+	_, err := s.events.Write([]byte{status, note, velocity})
+	return err
+}
+
+// function to drive the simulator from text commands such as "press grid 3 4",
+// "release top 2" or "press right 5"
+func (s *simLaunchpad) readCommands(lp *launchpad, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		b, err := simButton(lp, fields)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		switch fields[0] {
+		case "press":
+			err = s.press(b)
+		case "release":
+			err = s.release(b)
+		default:
+			fmt.Printf("Unknown simulator command: %s\n", fields[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// function to find the button named by a simulator command
+func simButton(lp *launchpad, fields []string) (*button, error) {
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("Invalid simulator command: %v", fields)
+	}
+	coords := make([]int, len(fields)-2)
+	for i, f := range fields[2:] {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 || n > 7 {
+			return nil, fmt.Errorf("Invalid simulator coordinate: %s", f)
+		}
+		coords[i] = n
+	}
+	switch fields[1] {
+	case "top":
+		return lp.topButtons[coords[0]], nil
+	case "right":
+		return lp.rightButtons[coords[0]], nil
+	case "grid":
+		if len(coords) != 2 {
+			return nil, fmt.Errorf("Grid buttons need a row and column: %v", fields)
+		}
+		return lp.gridButtons[coords[0]][coords[1]], nil
+	}
+	return nil, fmt.Errorf("Unknown button type: %s", fields[1])
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// file keeping the state of toggle pads, next to the macro config
+const toggleFileName = "toggles.toml"
+
+// default LED colors of toggle pads
+var (
+	defaultOnColor  = green
+	defaultOffColor = red
+)
+
+// time a query command may take when the pad has no timeout of its own
+const queryTimeout = 10 * time.Second
+
+// commands of a pad switching something on and off, such as mute and unmute
+type toggleCommands struct {
+	on       string // run when the pad is pressed while off
+	off      string // run when the pad is pressed while on
+	query    string // run at startup to find the real state, exiting successfully means on
+	onColor  Color  // LED color while on
+	offColor Color  // LED color while off
+}
+
+// function to check if the pad toggles
+func (t toggleCommands) any() bool {
+	return t.on != ""
+}
+
+// function to get the LED color of a state
+func (t toggleCommands) color(on bool) Color {
+	if on {
+		return t.onColor
+	}
+	return t.offColor
+}
+
+// state of a toggle pad, changed by the main loop
+type toggleState struct {
+	pad  [3]int // page, row and col of the pad
+	on   bool
+	done bool // the pad's on or off command exited, so the pad can be toggled again
+}
+
+// function to read the saved toggle states, a missing file leaves every toggle off
+func loadToggles(path string) (map[[3]int]bool, error) {
+	states := map[[3]int]bool{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	}
+	if err != nil {
+		return states, fmt.Errorf("Error reading toggle states: %v", err)
+	}
+	doc, err := parseToml(string(data))
+	if err != nil {
+		return states, fmt.Errorf("Error in toggle states %s: %v", path, err)
+	}
+	for _, t := range doc.arrays["toggle"] {
+		var pad [3]int
+		for i, key := range []string{"page", "row", "col"} {
+			n, ok, err := t.integer(key)
+			if err != nil || !ok {
+				return states, fmt.Errorf("Error in toggle states %s: line %d is missing %s", path, t.line, key)
+			}
+			pad[i] = n
+		}
+		on, _, err := t.boolean("on")
+		if err != nil {
+			return states, fmt.Errorf("Error in toggle states %s: %v", path, err)
+		}
+		states[pad] = on
+	}
+	return states, nil
+}
+
+// function to save the state of every toggle pad, states of pads that no longer toggle are dropped
+func (lp *launchpad) saveToggles() error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# state of the toggle pads, written by launchpad\n")
+	fmt.Fprintf(&b, "version = %d\n", configVersion)
+	for page := range lp.pages {
+		for row := range lp.pages[page] {
+			for col, m := range lp.pages[page][row] {
+				if !m.toggle.any() {
+					continue
+				}
+				fmt.Fprintf(&b, "\n[[toggle]]\n")
+				fmt.Fprintf(&b, "page = %d\nrow = %d\ncol = %d\n", page, row, col)
+				fmt.Fprintf(&b, "on = %t\n", lp.toggles[[3]int{page, row, col}])
+			}
+		}
+	}
+	if err := writeFileAtomic(lp.toggleFile, []byte(b.String())); err != nil {
+		return fmt.Errorf("Error writing toggle states: %v", err)
+	}
+	return nil
+}
+
+// function to run the on or off command of a toggle pad on a page, the state
+// changes once the command exits successfully. Presses while the command is
+// still running are ignored, so a double press doesn't run the same command twice.
+func (lp *launchpad) toggle(b *button, page int) error {
+	pad := [3]int{page, b.y, b.x}
+	if lp.toggling[pad] {
+		slog.Info("Toggle still running, ignoring press", "device", lp.device.id, "page", page, "row", b.y, "col", b.x)
+		return nil
+	}
+	on := !lp.toggles[pad]
+	command := b.toggle.off
+	if on {
+		command = b.toggle.on
+	}
+	lp.toggling[pad] = true
+	err := b.run(command, lp.runs, func(err error) {
+		// a failed command leaves the pad as it was
+		state := toggleState{pad: pad, on: on, done: true}
+		if err != nil {
+			state.on = !on
+		}
+		lp.post(event{kind: toggleEvent, toggle: state})
+	})
+	if err != nil {
+		delete(lp.toggling, pad)
+	}
+	return err
+}
+
+// function to change the state of a toggle pad in the main loop, saving it and relighting the pad
+func (lp *launchpad) setToggle(state toggleState, current Layer) {
+	if state.done {
+		delete(lp.toggling, state.pad)
+	}
+	if lp.toggles[state.pad] == state.on {
+		return
+	}
+	lp.toggles[state.pad] = state.on
+	slog.Info("Toggled macro", "device", lp.device.id, "page", state.pad[0], "row", state.pad[1], "col", state.pad[2], "on", state.on)
+	if err := lp.saveToggles(); err != nil {
+		slog.Error("Error saving toggle states", "device", lp.device.id, "err", err)
+	}
+
+	// only the shown page has the pad on the grid
+	if state.pad[0] != lp.page {
+		return
+	}
+	b := lp.gridButtons[state.pad[1]][state.pad[2]]
+	if !b.toggle.any() {
+		return
+	}
+	b.macroColor = b.toggle.color(state.on)
+	if _, ok := current.(*macroLayer); ok {
+		b.ledOn(b.macroColor)
+	}
+}
+
+// function to run the query command of every toggle pad, so the pads show the real state after a restart
+func (lp *launchpad) queryToggles() {
+	for page := range lp.pages {
+		for row := range lp.pages[page] {
+			for col, m := range lp.pages[page][row] {
+				if m.toggle.query == "" {
+					continue
+				}
+				go func() {
+					on, err := queryToggle(lp.ctx, m.toggle.query, m.options)
+					if err != nil {
+						slog.Warn("Error querying toggle, keeping the saved state", "device", lp.device.id, "page", page, "row", row, "col", col, "cmd", m.toggle.query, "err", err)
+						return
+					}
+					lp.post(event{kind: toggleEvent, toggle: toggleState{pad: [3]int{page, row, col}, on: on}})
+				}()
+			}
+		}
+	}
+}
+
+// function to run a query command, exiting successfully means on and any other exit status off
+func queryToggle(ctx context.Context, command string, options *execOptions) (bool, error) {
+	opts := defaultExec
+	if options != nil {
+		opts = *options
+	}
+	timeout := queryTimeout
+	if opts.timeout > 0 {
+		timeout = opts.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, opts.shell, "-c", command)
+	cmd.Dir = opts.dir
+	cmd.Env = append(os.Environ(), opts.env...)
+	err := cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return false, ctx.Err()
+	case errors.As(err, &exit):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
+// function to get the path of the toggle states of a macro config
+func toggleFile(macroFile string) string {
+	return filepath.Join(filepath.Dir(macroFile), toggleFileName)
+}
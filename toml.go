@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parsed TOML value: string, int64, bool or []string
+type tomlValue struct {
+	value any
+	line  int // line the value was defined on
+}
+
+// set of keys and values under one table header
+type tomlTable struct {
+	values map[string]tomlValue
+	used   map[string]bool // keys read by the decoder
+	name   string          // table name, empty for the root table
+	line   int             // line of the table header
+}
+
+// parsed TOML document, limited to the subset used by the config files: key = value pairs,
+// [table] and [[array]] headers, single line strings, decimal integers, booleans and arrays of
+// strings, which may span several lines
+type tomlDoc struct {
+	root   *tomlTable
+	tables map[string]*tomlTable   // [table] headers
+	arrays map[string][]*tomlTable // [[array]] headers in order
+}
+
+// error in a TOML file with its line number
+type tomlError struct {
+	line int
+	msg  string
+}
+
+func (e *tomlError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+// function to create an empty table
+func newTomlTable(name string, line int) *tomlTable {
+	return &tomlTable{values: map[string]tomlValue{}, used: map[string]bool{}, name: name, line: line}
+}
+
+// function to parse a TOML document
+func parseToml(data string) (*tomlDoc, error) {
+	doc := &tomlDoc{root: newTomlTable("", 0), tables: map[string]*tomlTable{}, arrays: map[string][]*tomlTable{}}
+	current := doc.root
+
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+
+		// [[array]] header
+		if strings.HasPrefix(line, "[[") {
+			if !strings.HasSuffix(line, "]]") {
+				return nil, &tomlError{n, "unterminated array table header"}
+			}
+			name := strings.TrimSpace(line[2 : len(line)-2])
+			if !validKey(name) {
+				return nil, &tomlError{n, fmt.Sprintf("invalid table name %q", name)}
+			}
+			current = newTomlTable(name, n)
+			doc.arrays[name] = append(doc.arrays[name], current)
+			continue
+		}
+
+		// [table] header
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, &tomlError{n, "unterminated table header"}
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if !validKey(name) {
+				return nil, &tomlError{n, fmt.Sprintf("invalid table name %q", name)}
+			}
+			if _, ok := doc.tables[name]; ok {
+				return nil, &tomlError{n, fmt.Sprintf("table [%s] defined twice", name)}
+			}
+			current = newTomlTable(name, n)
+			doc.tables[name] = current
+			continue
+		}
+
+		// key = value
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, &tomlError{n, fmt.Sprintf("expected key = value, got %q", line)}
+		}
+		key = strings.TrimSpace(key)
+		if !validKey(key) {
+			return nil, &tomlError{n, fmt.Sprintf("invalid key %q", key)}
+		}
+		if _, ok := current.values[key]; ok {
+			return nil, &tomlError{n, fmt.Sprintf("key %q defined twice", key)}
+		}
+		// arrays may span several lines
+		rest = strings.TrimSpace(rest)
+		for strings.HasPrefix(rest, "[") && !arrayClosed(rest) && i+1 < len(lines) {
+			i++
+			rest += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+		value, err := parseTomlValue(rest)
+		if err != nil {
+			return nil, &tomlError{n, err.Error()}
+		}
+		current.values[key] = tomlValue{value: value, line: n}
+	}
+	return doc, nil
+}
+
+// function to remove a trailing # comment that isn't inside a string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// function to check if an array has its closing bracket, brackets inside strings don't count
+func arrayClosed(s string) bool {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ']':
+			return true
+		}
+	}
+	return false
+}
+
+// function to check a bare key or table name, dots are allowed in table names
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// function to parse a single value
+func parseTomlValue(s string) (any, error) {
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("missing value")
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return nil, fmt.Errorf("multi-line strings aren't supported, write \\n in a basic string instead")
+	case s[0] == '"' || s[0] == '\'':
+		str, rest, err := parseTomlString(s)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected text after string: %q", rest)
+		}
+		return str, nil
+	case s[0] == '[':
+		return parseTomlArray(s)
+	}
+	// integers are decimal, TOML doesn't allow leading zeros so 010 isn't read as octal
+	digits := strings.TrimLeft(s, "+-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return nil, fmt.Errorf("invalid value %q, strings need quotes", s)
+	}
+	if len(digits) > 1 && digits[0] == '0' {
+		return nil, fmt.Errorf("invalid integer %q, only decimal integers without leading zeros are supported", s)
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(s, "_", ""), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid integer %q, only decimal integers without leading zeros are supported", s)
+	}
+	return n, nil
+}
+
+// function to parse a quoted string at the start of s, returning the rest of s
+func parseTomlString(s string) (string, string, error) {
+	// literal strings have no escapes
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+
+	// basic strings
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i >= len(s) {
+				return "", "", fmt.Errorf("unterminated string")
+			}
+			switch s[i] {
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u', 'U':
+				size := 4
+				if s[i] == 'U' {
+					size = 8
+				}
+				if i+size >= len(s) {
+					return "", "", fmt.Errorf("short unicode escape")
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", "", fmt.Errorf("invalid unicode escape \\%c%s", s[i], s[i+1:i+1+size])
+				}
+				b.WriteRune(rune(r))
+				i += size
+			default:
+				return "", "", fmt.Errorf("invalid escape \\%c", s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// function to parse an array of strings, the lines of a multi-line array are joined first
+func parseTomlArray(s string) ([]string, error) {
+	values := []string{}
+	rest := strings.TrimSpace(s[1:])
+	for {
+		if rest == "" {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if strings.HasPrefix(rest, "]") {
+			if strings.TrimSpace(rest[1:]) != "" {
+				return nil, fmt.Errorf("unexpected text after array: %q", rest[1:])
+			}
+			return values, nil
+		}
+		if rest[0] != '"' && rest[0] != '\'' {
+			return nil, fmt.Errorf("arrays may only hold quoted strings")
+		}
+		str, after, err := parseTomlString(rest)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, str)
+		rest = strings.TrimSpace(after)
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") {
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+// function to get a string value, ok is false when the key is missing
+func (t *tomlTable) str(key string) (string, bool, error) {
+	v, ok := t.get(key)
+	if !ok {
+		return "", false, nil
+	}
+	s, isStr := v.value.(string)
+	if !isStr {
+		return "", true, &tomlError{v.line, fmt.Sprintf("%s must be a string", key)}
+	}
+	return s, true, nil
+}
+
+// function to get an integer value, ok is false when the key is missing
+func (t *tomlTable) integer(key string) (int, bool, error) {
+	v, ok := t.get(key)
+	if !ok {
+		return 0, false, nil
+	}
+	n, isInt := v.value.(int64)
+	if !isInt {
+		return 0, true, &tomlError{v.line, fmt.Sprintf("%s must be an integer", key)}
+	}
+	return int(n), true, nil
+}
+
+// function to get a boolean value, ok is false when the key is missing
+func (t *tomlTable) boolean(key string) (bool, bool, error) {
+	v, ok := t.get(key)
+	if !ok {
+		return false, false, nil
+	}
+	b, isBool := v.value.(bool)
+	if !isBool {
+		return false, true, &tomlError{v.line, fmt.Sprintf("%s must be true or false", key)}
+	}
+	return b, true, nil
+}
+
+// function to get an array of strings, ok is false when the key is missing
+func (t *tomlTable) strings(key string) ([]string, bool, error) {
+	v, ok := t.get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	s, isArray := v.value.([]string)
+	if !isArray {
+		return nil, true, &tomlError{v.line, fmt.Sprintf("%s must be an array of strings", key)}
+	}
+	return s, true, nil
+}
+
+// function to get the line a key was defined on, or the table header line when missing
+func (t *tomlTable) lineOf(key string) int {
+	if v, ok := t.values[key]; ok {
+		return v.line
+	}
+	return t.line
+}
+
+// function to look up a key and mark it as used
+func (t *tomlTable) get(key string) (tomlValue, bool) {
+	v, ok := t.values[key]
+	if ok {
+		t.used[key] = true
+	}
+	return v, ok
+}
+
+// function to report the first key the decoder didn't read
+func (t *tomlTable) unknownKeys() error {
+	var first *tomlError
+	for key, v := range t.values {
+		if t.used[key] || (first != nil && first.line < v.line) {
+			continue
+		}
+		where := "top level"
+		if t.name != "" {
+			where = "[" + t.name + "]"
+		}
+		first = &tomlError{v.line, fmt.Sprintf("unknown key %q in %s", key, where)}
+	}
+	if first == nil {
+		return nil
+	}
+	return first
+}
+
+// function to quote a string as a TOML basic string
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7F {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// function to format an array of strings
+func tomlQuoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = tomlQuote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// strings that need escaping in a TOML basic string
+var tomlStrings = []string{
+	"",
+	"echo hi",
+	`say "hello"`,
+	`C:\path\to\file`,
+	`\"`,
+	`ends with a backslash \`,
+	"notify-send '#1' # not a comment",
+	"#",
+	"printf 'a\tb\n'\r",
+	"bell \a, escape \x1b[0m, delete \x7f, null \x00",
+	"ünïcödé ♫ 🎹",
+	`\u0041 stays as text`,
+}
+
+func TestTomlQuoteRoundTrip(t *testing.T) {
+	for _, s := range tomlStrings {
+		quoted := tomlQuote(s)
+		got, rest, err := parseTomlString(quoted)
+		if err != nil {
+			t.Errorf("Error parsing %s: %v", quoted, err)
+			continue
+		}
+		if got != s || rest != "" {
+			t.Errorf("parseTomlString(%s) = %q, rest %q, want %q", quoted, got, rest, s)
+		}
+		// quoted strings stay on one line without raw control characters
+		if strings.ContainsFunc(quoted, func(r rune) bool { return r < 0x20 || r == 0x7F }) {
+			t.Errorf("tomlQuote(%q) = %s has raw control characters", s, quoted)
+		}
+	}
+}
+
+func TestTomlQuoteInDocument(t *testing.T) {
+	// values keep their # and quotes, the comment after them is dropped
+	var b strings.Builder
+	for i, s := range tomlStrings {
+		b.WriteString("[[pad]]\n")
+		b.WriteString("cmd = " + tomlQuote(s) + " # comment " + string(rune('a'+i)) + "\n")
+	}
+	b.WriteString("all = " + tomlQuoteAll(tomlStrings) + " # the same strings\n")
+	doc, err := parseToml(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range tomlStrings {
+		if got, _, err := doc.arrays["pad"][i].str("cmd"); err != nil || got != s {
+			t.Errorf("cmd %d = %q, %v, want %q", i, got, err, s)
+		}
+	}
+	if got, _, err := doc.arrays["pad"][len(tomlStrings)-1].strings("all"); err != nil || !slices.Equal(got, tomlStrings) {
+		t.Errorf("all = %q, %v, want %q", got, err, tomlStrings)
+	}
+}
+
+func TestParseTomlString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		rest string
+		err  string
+	}{
+		{in: `"abc" # x`, want: "abc", rest: " # x"},
+		{in: `'C:\no\escapes' x`, want: `C:\no\escapes`, rest: " x"},
+		{in: `'say "hi"'`, want: `say "hi"`},
+		{in: `"a\"b\\c"`, want: `a"b\c`},
+		{in: `"\n\t\r\b\f"`, want: "\n\t\r\b\f"},
+		{in: `"\u0041\u00e9\u266B"`, want: "Aé♫"},
+		{in: `"\U0001F3B9"`, want: "🎹"},
+		{in: `"#"`, want: "#"},
+		{in: `"abc`, err: "unterminated string"},
+		{in: `'abc`, err: "unterminated string"},
+		{in: `"abc\`, err: "unterminated string"},
+		{in: `"abc\"`, err: "unterminated string"},
+		{in: `"\u00"`, err: "short unicode escape"},
+		{in: `"\u00zz"`, err: "invalid unicode escape"},
+		{in: `"\uD800"`, err: "invalid unicode escape"},
+		{in: `"\U00110000"`, err: "invalid unicode escape"},
+		{in: `"\x41"`, err: "invalid escape \\x"},
+	}
+	for _, test := range tests {
+		got, rest, err := parseTomlString(test.in)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("parseTomlString(%s) returned %v, want %q", test.in, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want || rest != test.rest {
+			t.Errorf("parseTomlString(%s) = %q, %q, %v, want %q, %q", test.in, got, rest, err, test.want, test.rest)
+		}
+	}
+}
+
+func FuzzTomlQuote(f *testing.F) {
+	for _, s := range tomlStrings {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		// only valid UTF-8 is saved, the config file is text
+		if !utf8.ValidString(s) {
+			return
+		}
+		got, rest, err := parseTomlString(tomlQuote(s))
+		if err != nil || got != s || rest != "" {
+			t.Fatalf("Round trip of %q gave %q, rest %q, err %v", s, got, rest, err)
+		}
+	})
+}
+
+func TestParseTomlSubset(t *testing.T) {
+	doc, err := parseToml(`layers = [
+	"paint",  # the first layer
+	"macro",
+	'[not] # the end',
+]
+row = 10
+col = +7
+count = 1_000
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := doc.root.strings("layers"); err != nil || !slices.Equal(got, []string{"paint", "macro", "[not] # the end"}) {
+		t.Errorf("layers = %q, %v", got, err)
+	}
+	if line := doc.root.lineOf("layers"); line != 1 {
+		t.Errorf("layers on line %d, want 1", line)
+	}
+	for key, want := range map[string]int{"row": 10, "col": 7, "count": 1000} {
+		if got, _, err := doc.root.integer(key); err != nil || got != want {
+			t.Errorf("%s = %d, %v, want %d", key, got, err, want)
+		}
+	}
+	// keys after a multi-line array keep their own line numbers
+	if line := doc.root.lineOf("row"); line != 6 {
+		t.Errorf("row on line %d, want 6", line)
+	}
+}
+
+func TestParseTomlUnsupported(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"row = 010", `line 1: invalid integer "010", only decimal integers without leading zeros are supported`},
+		{"row = 0x10", `line 1: invalid integer "0x10"`},
+		{"row = 1e3", `line 1: invalid integer "1e3"`},
+		{"cmd = echo", `line 1: invalid value "echo", strings need quotes`},
+		{`cmd = """echo"""`, "line 1: multi-line strings aren't supported"},
+		{"cmd = '''echo'''", "line 1: multi-line strings aren't supported"},
+		{"layers = [\n\"paint\",\n", "line 1: unterminated array"},
+		{"layers = [\"paint\", 1]", "line 1: arrays may only hold quoted strings"},
+	}
+	for _, test := range tests {
+		if _, err := parseToml(test.in); err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("parseToml(%q) returned %v, want %q", test.in, err, test.want)
+		}
+	}
+}
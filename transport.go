@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// transport names selectable with the -transport flag
+const (
+	rawmidiName = "rawmidi"
+	amidiName   = "amidi"
+	simName     = "sim"
+)
+
+// transport used to exchange midi messages with the launchpad
+type transport interface {
+	send(msg []byte) error           // write a single midi message to the device
+	receive() (io.ReadCloser, error) // stream of raw midi bytes received from the device
+	close() error                    // release the connection to the device
+}
+
+// function to open the transport selected by transportName for a midi port
+func openTransport(port string) (transport, error) {
+	switch transportName {
+	case rawmidiName:
+		t, err := openRawmidi(port)
+		if err == nil {
+			return t, nil
+		}
+		// fall back to amidi if the rawmidi device can't be opened
+		slog.Warn("Error opening rawmidi device, falling back to amidi", "port", port, "err", err)
+		return &amidiTransport{port: port}, nil
+	case amidiName:
+		return &amidiTransport{port: port}, nil
+	case simName:
+		return newSimLaunchpad(), nil
+	}
+	return nil, fmt.Errorf("Unknown transport: %s", transportName)
+}
+
+// long lived connection to the launchpad through the ALSA rawmidi device file
+type rawmidiTransport struct {
+	port string   // amidi port in format "hw:x,x,x"
+	file *os.File // open /dev/snd/midiC*D* file
+}
+
+// function to open the rawmidi device file for an amidi port
+func openRawmidi(port string) (*rawmidiTransport, error) {
+	path, err := rawmidiPath(port)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening %s: %v", path, err)
+	}
+	slog.Debug("Opened rawmidi device", "path", path)
+	return &rawmidiTransport{port: port, file: f}, nil
+}
+
+// function to convert an amidi port in format "hw:x,x,x" to a rawmidi device path
+func rawmidiPath(port string) (string, error) {
+	fields := strings.Split(strings.TrimPrefix(port, "hw:"), ",")
+	if len(fields) < 2 {
+		return "", fmt.Errorf("Invalid midi port: %s", port)
+	}
+	// the device file opens the first free subdevice, later ones such as the X's MIDI port need amidi
+	if len(fields) > 2 && fields[2] != "0" {
+		return "", fmt.Errorf("Rawmidi device files can't select subdevice %s of %s", fields[2], port)
+	}
+	return fmt.Sprintf("/dev/snd/midiC%sD%s", fields[0], fields[1]), nil
+}
+
+// function to write a midi message to the rawmidi device
+func (t *rawmidiTransport) send(msg []byte) error {
+	_, err := t.file.Write(msg)
+	return err
+}
+
+// function to receive midi messages read from the rawmidi device
+func (t *rawmidiTransport) receive() (io.ReadCloser, error) {
+	// the device is closed by close, not by the reader
+	return io.NopCloser(t.file), nil
+}
+
+// function to close the rawmidi device
+func (t *rawmidiTransport) close() error {
+	return t.file.Close()
+}
+
+// connection to the launchpad that starts an amidi process for every message
+type amidiTransport struct {
+	port string // amidi port in format "hw:x,x,x"
+
+	mu   sync.Mutex
+	dump *amidiDump // process receiving input, nil until receive is called
+}
+
+// function to send a midi message with amidi
+func (t *amidiTransport) send(msg []byte) error {
+	hex := make([]string, len(msg))
+	for i, c := range msg {
+		hex[i] = fmt.Sprintf("%02X", c)
+	}
+	cmd := exec.Command(lpCmd, "-p", t.port, "-S", strings.Join(hex, " "))
+	return cmd.Run()
+}
+
+// function to receive midi messages from amidi
+func (t *amidiTransport) receive() (io.ReadCloser, error) {
+	dump, err := startAmidiDump(t.port)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.dump = dump
+	t.mu.Unlock()
+	return dump, nil
+}
+
+// function to close the amidi transport, stopping the amidi process receiving input
+func (t *amidiTransport) close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dump == nil {
+		return nil
+	}
+	return t.dump.Close()
+}
+
+// amidi process writing received midi bytes to its stdout
+type amidiDump struct {
+	io.ReadCloser
+	cmd  *exec.Cmd
+	once sync.Once
+	err  error // result of stopping the process
+}
+
+// function to start an amidi process receiving raw input from a port
+func startAmidiDump(port string) (*amidiDump, error) {
+	cmd := exec.Command(lpCmd, "-p", port, "-r", "/dev/stdout")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("Error creating stdout: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Error starting amidi: %v", err)
+	}
+	return &amidiDump{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// function to stop the amidi process, later calls return the same result
+func (d *amidiDump) Close() error {
+	d.once.Do(func() {
+		d.cmd.Process.Kill()
+		d.err = d.cmd.Wait()
+	})
+	return d.err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// inotify events meaning the macro config has new contents, editors often
+// save by writing a temporary file and renaming it over the old one
+const configEvents = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO
+
+// time to wait for further changes before reloading the macro config
+const reloadDelay = 200 * time.Millisecond
+
+// function to reload the macro config whenever the file changes, until the launchpad shuts down
+func (lp *launchpad) watchConfig() {
+	// non blocking so reads wait in the runtime poller and can be interrupted by closing the file
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		slog.Error("Error watching macro config", "err", err)
+		return
+	}
+	events := os.NewFile(uintptr(fd), "inotify")
+	defer events.Close()
+
+	// watch the directory so the file can be replaced rather than rewritten
+	dir, name := filepath.Split(lp.macroFile)
+	if _, err := syscall.InotifyAddWatch(fd, dir, configEvents); err != nil {
+		slog.Error("Error watching macro config", "file", lp.macroFile, "err", err)
+		return
+	}
+
+	// stop reading on shutdown
+	go func() {
+		<-lp.ctx.Done()
+		events.Close()
+	}()
+
+	// contents last read, saves by this program and repeated events don't reload the same text again
+	current, _ := os.ReadFile(lp.macroFile)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := events.Read(buf)
+		if lp.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Error("Error watching macro config", "file", lp.macroFile, "err", err)
+			return
+		}
+		if !inotifyNames(buf[:n])[name] {
+			continue
+		}
+		time.Sleep(reloadDelay)
+
+		data, err := os.ReadFile(lp.macroFile)
+		if err != nil {
+			slog.Error("Error reloading macro config", "file", lp.macroFile, "err", err)
+			continue
+		}
+		if bytes.Equal(data, current) {
+			continue
+		}
+		current = data
+		if err := lp.reloadMacros(data); err != nil {
+			slog.Error("Invalid macro config, keeping the previous macros", "err", err)
+			lp.flashTop(red)
+		}
+	}
+}
+
+// function to get the file names in a buffer of inotify events
+func inotifyNames(buf []byte) map[string]bool {
+	names := map[string]bool{}
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		// the name follows the fixed size event, padded with null bytes
+		size := int(binary.NativeEndian.Uint32(buf[12:16]))
+		end := min(syscall.SizeofInotifyEvent+size, len(buf))
+		name := bytes.TrimRight(buf[syscall.SizeofInotifyEvent:end], "\x00")
+		names[string(name)] = true
+		buf = buf[end:]
+	}
+	return names
+}
+
+// function to replace the macros with a changed config, the current macros stay when it is invalid
+func (lp *launchpad) reloadMacros(data []byte) error {
+	cfg, err := parseConfig(string(data))
+	if err != nil {
+		return fmt.Errorf("Error in macro config %s: %v", lp.macroFile, err)
+	}
+	lp.post(event{kind: configEvent, config: cfg})
+	return nil
+}
+
+// function to apply a reloaded config in the main loop
+func (lp *launchpad) applyConfig(cfg *macroConfig, current Layer) {
+	lp.setMacros(cfg)
+	slog.Info("Reloaded macros", "device", lp.device.id, "count", len(cfg.pads), "file", lp.macroFile)
+
+	// layers keep running until the next start
+	if !slices.Equal(configLayers(cfg), lp.layerNames()) {
+		slog.Info("Layer changes take effect after a restart", "file", lp.macroFile)
+	}
+
+	// show the new bindings in the layers that light them
+	switch l := current.(type) {
+	case *macroLayer, *recordLayer:
+		lp.gridOff()
+		lp.macroLights()
+	case *automatonLayer:
+		if err := l.configure(); err != nil {
+			slog.Error("Error applying automaton config", "device", lp.device.id, "layer", l.name, "err", err)
+		}
+		l.draw()
+	}
+}
+
+// function to flash every top row button, used to report errors
+func (lp *launchpad) flashTop(color Color) {
+	for _, b := range lp.topButtons {
+		go b.flash(color, 3, 333/2)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// function to encode an inotify event with its name padded to a length
+func inotifyEvent(name string, size int) []byte {
+	buf := make([]byte, syscall.SizeofInotifyEvent+size)
+	binary.NativeEndian.PutUint32(buf[4:8], syscall.IN_CLOSE_WRITE)
+	binary.NativeEndian.PutUint32(buf[12:16], uint32(size))
+	copy(buf[syscall.SizeofInotifyEvent:], name)
+	return buf
+}
+
+func TestInotifyNames(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+		want []string
+	}{
+		{"one event", inotifyEvent("macros.toml", 16), []string{"macros.toml"}},
+		{"exact length", inotifyEvent("macros.toml", 11), []string{"macros.toml"}},
+		{"several events", slices.Concat(inotifyEvent(".macros.toml.swp", 32), inotifyEvent("macros.toml", 16), inotifyEvent("macros.toml", 16)), []string{".macros.toml.swp", "macros.toml"}},
+		{"no name", inotifyEvent("", 0), []string{""}},
+		{"truncated name", inotifyEvent("macros.toml", 16)[:20], []string{"macr"}},
+		{"truncated header", inotifyEvent("macros.toml", 16)[:10], nil},
+		{"empty", nil, nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for name := range inotifyNames(test.buf) {
+			got = append(got, name)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: inotifyNames = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReloadBadConfig(t *testing.T) {
+	lp, sim := startSim(t, "version = 1\n\n[[pad]]\nrow = 0\ncol = 0\ncmd = \"true\"\n")
+	switchTo(t, lp, sim, topMacro)
+	b := lp.gridButtons[0][0]
+	waitLED(t, sim, b, defaultColor)
+
+	bad := "version = 1\n\n[[pad]]\nrow = 9\ncol = 0\ncmd = \"true\"\n"
+	if err := lp.reloadMacros([]byte(bad)); err == nil || !strings.Contains(err.Error(), "Error in macro config") {
+		t.Errorf("reloadMacros returned %v, want the config error", err)
+	}
+
+	// a hand edit with a mistake flashes the top row red and keeps the macros
+	if err := os.WriteFile(lp.macroFile, []byte(bad), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, top := range lp.topButtons {
+		waitLED(t, sim, top, red)
+	}
+	resp := dispatchControl(controlRequest{Command: "macros"}, []*launchpad{lp})
+	if !slices.Equal(resp.Lines, []string{"0\t0\t0\tamber\ttrue"}) {
+		t.Errorf("macros after the bad config: %q", resp.Lines)
+	}
+	if sim.led(b).plain() != defaultColor {
+		t.Errorf("pad shows %v after the bad config, want %v", sim.led(b), defaultColor)
+	}
+
+	// fixing the mistake loads the new macros
+	if err := os.WriteFile(lp.macroFile, []byte("version = 1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	waitLED(t, sim, b, off)
+}